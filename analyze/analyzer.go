@@ -3,19 +3,127 @@ package analyze
 import (
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/analyze/flow"
+	"github.com/maride/pancap/analyze/stream"
+	"github.com/maride/pancap/filter"
 	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/progress"
 	"github.com/maride/pancap/protocol"
 )
 
-var (
-	// Store total amount and amount of visited packets
+// Amount of packets queued for each worker before the decoder blocks
+const queueSize = 1024
+
+// Analyzer holds the state of a single analysis
+type Analyzer struct {
+	modules   []protocol.Module
+	protocols []protocol.Protocol
+	flows     *flow.Table
+	streams   *stream.Service
+	graph     *output.Graph
+	options   Options
+
+	// Store total amount, amount of packets inside the time window, amount of packets matching the filter and amount of visited packets
 	totalPackets     int
+	windowPackets    int
+	matchedPackets   int
 	processedPackets int
-)
 
-func Analyze(source *gopacket.PacketSource) error {
+	// Breakdown of the packets no module processed
+	unprocessed unprocessedStats
+
+	// Errors encountered by each module
+	errors []*errorStats
+
+	// Timestamp of the first packet of the capture, and the time spans of the packets seen overall and by each module
+	start       time.Time
+	previous    time.Time
+	unsorted    bool
+	windowEnded bool
+	span        output.Span
+	moduleSpans []output.Span
+}
+
+// Options restrict and observe an analysis, all of them are optional
+type Options struct {
+	// Only packets matching the filter are analyzed
+	Filter *filter.Filter
+	// Only packets captured in the window are analyzed
+	Window *filter.Window
+	// Reports the progress while analyzing
+	Progress *progress.Reporter
+	// Log every error of a module, instead of only counting them
+	VerboseErrors bool
+	// List a few examples for each kind of error in the summary
+	ErrorExamples bool
+}
+
+// Creates a new analyzer, running fresh instances of the given modules and adding communication to the given graph.
+// Flows and TCP connections are tracked in the flow table and stream service of the context, which are created if missing.
+func New(ctx *protocol.Context, modules []protocol.Module, graph *output.Graph, options Options) *Analyzer {
+	if ctx.Flows == nil {
+		ctx.Flows = flow.NewTable()
+	}
+	if ctx.Streams == nil {
+		ctx.Streams = stream.NewService(ctx.Flows, "")
+	}
+
+	errors := make([]*errorStats, len(modules))
+	for i, m := range modules {
+		errors[i] = newErrorStats(m.Name, options.VerboseErrors)
+	}
+
+	return &Analyzer{
+		modules:     modules,
+		protocols:   protocol.New(ctx, modules),
+		flows:       ctx.Flows,
+		streams:     ctx.Streams,
+		graph:       graph,
+		options:     options,
+		moduleSpans: make([]output.Span, len(modules)),
+		unprocessed: newUnprocessedStats(),
+		errors:      errors,
+	}
+}
+
+// Analyzes all packets of the given source.
+// Packets are read and decoded on the calling goroutine, and handed over to a worker goroutine per module.
+// Each module sees all packets it can analyze in capture order, one at a time, so modules don't need to lock their state.
+// CanAnalyze is called on the decoding goroutine, which is why it must not rely on the state of the module.
+// Analyze returns after all workers are done.
+func (a *Analyzer) Analyze(source *gopacket.PacketSource) error {
+	var wg, streamWG sync.WaitGroup
+
+	// Report progress until all workers are done
+	a.options.Progress.Start()
+	defer a.options.Progress.Stop()
+
+	// Start a worker for each module...
+	queues := make([]chan gopacket.Packet, len(a.protocols))
+	for i, p := range a.protocols {
+		p := p
+		errors := a.errors[i]
+		queues[i] = startWorker(&wg, func(packet gopacket.Packet) {
+			errors.handle(p.Analyze(packet))
+		}, func() {
+			// Give the module a chance to finish its work
+			if f, ok := p.(protocol.Finalizer); ok {
+				errors.handle(f.Finalize())
+			}
+		})
+	}
+
+	// ... and one reassembling TCP connections and UDP pseudo-streams, if anyone is interested in them
+	var streamQueue chan gopacket.Packet
+	if a.streams.Active() {
+		streamQueue = startWorker(&streamWG, a.streams.Add, a.streams.Close)
+	}
+
 	// Loop over all packets now
 	for {
 		packet, packetErr := source.NextPacket()
@@ -28,47 +136,158 @@ func Analyze(source *gopacket.PacketSource) error {
 			continue
 		}
 
+		a.options.Progress.Packet()
+
+		// Skip packets outside of the time window, and those not matching the filter, before any module sees them
+		timestamp := packet.Metadata().Timestamp
+		if a.totalPackets == 0 {
+			a.start = timestamp
+		}
+		a.unsorted = a.unsorted || timestamp.Before(a.previous)
+		a.previous = timestamp
+		a.totalPackets += 1
+		if a.options.Window != nil && !a.options.Window.Contains(timestamp, a.start) {
+			if !a.unsorted && a.options.Window.Ended(timestamp, a.start) {
+				// The packets were in order so far, so the remaining packets are most likely past the window as well
+				a.windowEnded = true
+				break
+			}
+			continue
+		}
+		a.windowPackets += 1
+		if a.options.Filter != nil && !a.options.Filter.Match(packet.Data()) {
+			continue
+		}
+		a.matchedPackets += 1
+		a.span.Extend(timestamp)
+
+		// Add the packet to its flow, so modules can look it up
+		a.flows.Add(packet)
+		if streamQueue != nil && (packet.Layer(layers.LayerTypeTCP) != nil || packet.Layer(layers.LayerTypeUDP) != nil) {
+			streamQueue <- packet
+		}
+
 		// Track if we didn't process a packet
 		processed := false
 
 		// Iterate over all possible protocols
-		for _, p := range protocol.Protocols {
-			// Check if this protocol can handle this packet
+		for i, p := range a.protocols {
+			// Check if this protocol can handle this packet, and hand it over to its worker
 			if p.CanAnalyze(packet) {
-				handleErr(p.Analyze(packet))
-				processed = true
+				queues[i] <- packet
+				a.moduleSpans[i].Extend(timestamp)
+				if !a.modules[i].Observer {
+					processed = true
+				}
 			}
 		}
 
-		// Register communication for graph
-		output.AddPkgToGraph(packet)
-
 		// Raise statistics
-		totalPackets += 1
 		if processed {
-			processedPackets += 1
+			a.processedPackets += 1
+		} else {
+			a.unprocessed.add(packet)
+		}
+	}
+
+	// Close all TCP connections first, so modules can wait for their subscriptions while finalizing
+	if streamQueue != nil {
+		close(streamQueue)
+		streamWG.Wait()
+	}
+
+	// Shut down all workers and wait for them to process the remaining packets and finalize
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+
+	// Register communication for graph, with an edge for each direction packets were sent in
+	for _, f := range a.flows.Flows() {
+		stats := f.Stats()
+		if stats.ClientToServer.Packets > 0 {
+			a.graph.AddFlow(f.Client.Address, f.Server.Address, f.Service())
+		}
+		if stats.ServerToClient.Packets > 0 {
+			a.graph.AddFlow(f.Server.Address, f.Client.Address, f.Service())
 		}
 	}
 
 	return nil
 }
 
-// Prints all the summaries.
-func PrintSummary() {
-	// First, print base information collected while analyzing
-	content := fmt.Sprintf("Processed %d out of %d packets (%d%%)", processedPackets, totalPackets, processedPackets*100/totalPackets)
-	output.PrintBlock("Overall statistics", content)
+// Starts a goroutine handing every packet sent to the returned channel over to handle.
+// After the channel is closed and all packets are handled, finish is called (if given) and the goroutine stops.
+func startWorker(wg *sync.WaitGroup, handle func(gopacket.Packet), finish func()) chan gopacket.Packet {
+	queue := make(chan gopacket.Packet, queueSize)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for packet := range queue {
+			handle(packet)
+		}
+		if finish != nil {
+			finish()
+		}
+	}()
+
+	return queue
+}
+
+// Returns all the summaries.
+func (a *Analyzer) Summary() []output.Block {
+	// First, add base information collected while analyzing
+	overall := output.Block{Headline: "Overall statistics", Span: spanOrNil(a.span)}
+	if a.options.Window != nil {
+		line := fmt.Sprintf("Time window %s contains %d out of %d packets (%d%%)", a.options.Window, a.windowPackets, a.totalPackets, percentage(a.windowPackets, a.totalPackets))
+		if a.windowEnded {
+			line += ", stopped reading at the end of the window"
+		}
+		overall.Add(output.Text{Line: line})
+	}
+	if a.options.Filter != nil {
+		overall.Add(output.Text{Line: fmt.Sprintf("Filter '%s' matched %d out of %d packets (%d%%)", a.options.Filter, a.matchedPackets, a.windowPackets, percentage(a.matchedPackets, a.windowPackets))})
+	}
+	overall.Add(output.Text{Line: fmt.Sprintf("Processed %d out of %d packets (%d%%)", a.processedPackets, a.matchedPackets, percentage(a.processedPackets, a.matchedPackets))})
+	overall.Add(a.unprocessed.items()...)
+	blocks := []output.Block{overall}
+
+	// Add the errors the modules encountered, if any
+	if errorBlock := errorSummary(a.errors, a.options.ErrorExamples); errorBlock != nil {
+		blocks = append(blocks, *errorBlock)
+	}
+
+	// Add statistics about the reassembled streams, if they were reassembled at all
+	if a.streams.Active() {
+		blocks = append(blocks, a.streams.Summary())
+	}
+
+	// Add summary of each protocol, stating the time span of the packets the module saw unless the module did so itself
+	for i, p := range a.protocols {
+		for _, b := range p.Summary() {
+			if b.Span == nil {
+				b.Span = spanOrNil(a.moduleSpans[i])
+			}
+			blocks = append(blocks, b)
+		}
+	}
+
+	return blocks
+}
 
-	// Print summary of each protocol
-	for _, p := range protocol.Protocols {
-		p.PrintSummary()
+// Returns a pointer to the given span, or nil if it is empty
+func spanOrNil(span output.Span) *output.Span {
+	if span.IsEmpty() {
+		return nil
 	}
+	return &span
 }
 
-// Handles an error, if err is not nil.
-func handleErr(err error) {
-	// (hopefully) most calls to this function will contain a nil error, so we need to check if we really got an error
-	if err != nil {
-		log.Printf("Encountered error while examining packets, continuing anyway. Error: %s", err.Error())
+// Returns part in percent of total, avoiding a division by zero for empty captures
+func percentage(part int, total int) int {
+	if total == 0 {
+		return 0
 	}
+	return part * 100 / total
 }
@@ -0,0 +1,119 @@
+package analyze
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+
+	"github.com/maride/pancap/output"
+)
+
+// Amount of example messages kept for each kind of error
+const maxErrorExamples = 3
+
+// Matches numbers in error messages, which are replaced to group errors of the same kind
+var numberPattern = regexp.MustCompile(`0x[0-9a-fA-F]+|[0-9]+`)
+
+// Counts the errors of a single module by their kind.
+// Each module has its own statistics, only touched by its worker, so no locking is required.
+type errorStats struct {
+	module  string
+	verbose bool
+	kinds   map[string]*errorKind
+}
+
+// A kind of error, along with a few examples of it
+type errorKind struct {
+	count    int
+	examples []string
+}
+
+// Creates empty statistics for the given module. If verbose is set, every error is logged, too.
+func newErrorStats(module string, verbose bool) *errorStats {
+	return &errorStats{
+		module:  module,
+		verbose: verbose,
+		kinds:   make(map[string]*errorKind),
+	}
+}
+
+// Counts the given error, if it is not nil
+func (e *errorStats) handle(err error) {
+	// (hopefully) most calls to this function will contain a nil error, so we need to check if we really got an error
+	if err == nil {
+		return
+	}
+
+	if e.verbose {
+		log.Printf("Encountered error in module %s while examining packets, continuing anyway. Error: %s", e.module, err.Error())
+	}
+
+	// Group errors differing only in numbers, e.g. offsets or lengths
+	message := err.Error()
+	kind := numberPattern.ReplaceAllString(message, "N")
+
+	k, ok := e.kinds[kind]
+	if !ok {
+		k = &errorKind{}
+		e.kinds[kind] = k
+	}
+	k.count++
+	if len(k.examples) < maxErrorExamples {
+		k.examples = append(k.examples, message)
+	}
+}
+
+// Returns the total amount of errors
+func (e *errorStats) total() int {
+	total := 0
+	for _, k := range e.kinds {
+		total += k.count
+	}
+	return total
+}
+
+// Returns the summary of the errors of all given modules, or nil if there were none.
+// If examples is set, a few example messages are listed for each kind of error.
+func errorSummary(stats []*errorStats, examples bool) *output.Block {
+	table := output.Table{
+		Columns: []string{"Module", "Error", "Count"},
+	}
+	var exampleLists []output.Item
+	total := 0
+
+	for _, s := range stats {
+		total += s.total()
+
+		// Sort kinds by their count, most frequent first
+		kinds := make([]string, 0, len(s.kinds))
+		for k := range s.kinds {
+			kinds = append(kinds, k)
+		}
+		sort.Slice(kinds, func(i, j int) bool {
+			if s.kinds[kinds[i]].count != s.kinds[kinds[j]].count {
+				return s.kinds[kinds[i]].count > s.kinds[kinds[j]].count
+			}
+			return kinds[i] < kinds[j]
+		})
+
+		for _, k := range kinds {
+			table.AddRow(s.module, k, s.kinds[k].count)
+			if examples {
+				exampleLists = append(exampleLists, output.List{
+					Title:   fmt.Sprintf("Examples of '%s' in %s", k, s.module),
+					Entries: s.kinds[k].examples,
+				})
+			}
+		}
+	}
+
+	if len(table.Rows) == 0 {
+		return nil
+	}
+
+	block := &output.Block{Headline: output.ErrorsHeadline}
+	block.Add(output.Count{Name: "errors", Value: total, Label: "errors in total"}, table)
+	block.Add(exampleLists...)
+	return block
+}
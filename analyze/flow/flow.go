@@ -0,0 +1,285 @@
+// Package flow keeps track of the flows of an analysis, each identified by its 5-tuple regardless of the direction.
+//
+// The analyzer adds every packet to the flow table before any module sees it,
+// so modules can look up the flow of a packet and annotate it with what they learned, e.g. the HTTP host.
+// Modules run concurrently, which is why flows may only be accessed through their methods.
+package flow
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/capture"
+)
+
+// Endpoint is one side of a flow
+type Endpoint struct {
+	Address string
+	// Port, or 0 for protocols without ports like ICMP
+	Port uint16
+}
+
+// Key identifies a flow in both directions. A is always the lower endpoint.
+type Key struct {
+	Protocol layers.IPProtocol
+	A        Endpoint
+	B        Endpoint
+}
+
+// Flow is the communication between two endpoints, with the endpoint sending the first packet considered as client
+type Flow struct {
+	// Sequential number of the flow, in order of the first packet
+	ID     int
+	Key    Key
+	Client Endpoint
+	Server Endpoint
+	// Name of the file the first packet of the flow was read from, if several files were merged
+	Origin string
+
+	lock        sync.Mutex
+	stats       Stats
+	annotations map[string]string
+}
+
+// Stats are the packets and bytes sent in a flow
+type Stats struct {
+	Start          time.Time
+	End            time.Time
+	ClientToServer Counter
+	ServerToClient Counter
+}
+
+// Counter holds the amount of packets and bytes sent in one direction
+type Counter struct {
+	Packets int
+	Bytes   int
+}
+
+// Table holds all flows of an analysis
+type Table struct {
+	lock  sync.RWMutex
+	flows map[Key]*Flow
+	order []*Flow
+}
+
+// Creates a new, empty flow table
+func NewTable() *Table {
+	return &Table{
+		flows: make(map[Key]*Flow),
+	}
+}
+
+// Creates the key for a flow between the given endpoints, regardless of their order
+func NewKey(protocol layers.IPProtocol, src Endpoint, dst Endpoint) Key {
+	if dst.less(src) {
+		src, dst = dst, src
+	}
+	return Key{Protocol: protocol, A: src, B: dst}
+}
+
+// KeyOf returns the key of the flow the given packet belongs to, along with its sender.
+// Returns false if the packet isn't an IP packet.
+func KeyOf(packet gopacket.Packet) (Key, Endpoint, bool) {
+	var protocol layers.IPProtocol
+	var srcAddr, dstAddr string
+
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		protocol, srcAddr, dstAddr = ip.Protocol, ip.SrcIP.String(), ip.DstIP.String()
+	case *layers.IPv6:
+		protocol, srcAddr, dstAddr = ip.NextHeader, ip.SrcIP.String(), ip.DstIP.String()
+	default:
+		return Key{}, Endpoint{}, false
+	}
+
+	src := Endpoint{Address: srcAddr}
+	dst := Endpoint{Address: dstAddr}
+	switch t := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		protocol, src.Port, dst.Port = layers.IPProtocolTCP, uint16(t.SrcPort), uint16(t.DstPort)
+	case *layers.UDP:
+		protocol, src.Port, dst.Port = layers.IPProtocolUDP, uint16(t.SrcPort), uint16(t.DstPort)
+	case *layers.SCTP:
+		protocol, src.Port, dst.Port = layers.IPProtocolSCTP, uint16(t.SrcPort), uint16(t.DstPort)
+	}
+
+	return NewKey(protocol, src, dst), src, true
+}
+
+// KeyFromFlows returns the key of the TCP or UDP flow described by the given gopacket flows, e.g. as handed over by tcpassembly
+func KeyFromFlows(net gopacket.Flow, transport gopacket.Flow) Key {
+	protocol := layers.IPProtocolTCP
+	if transport.EndpointType() == layers.EndpointUDPPort {
+		protocol = layers.IPProtocolUDP
+	}
+
+	src := Endpoint{Address: net.Src().String(), Port: Port(transport.Src())}
+	dst := Endpoint{Address: net.Dst().String(), Port: Port(transport.Dst())}
+	return NewKey(protocol, src, dst)
+}
+
+// Port returns the port of the given transport endpoint, or 0 if it has none
+func Port(e gopacket.Endpoint) uint16 {
+	raw := e.Raw()
+	if len(raw) != 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(raw)
+}
+
+// Add adds the given packet to its flow, creating the flow if necessary.
+// Returns nil if the packet isn't an IP packet.
+func (t *Table) Add(packet gopacket.Packet) *Flow {
+	key, src, ok := KeyOf(packet)
+	if !ok {
+		return nil
+	}
+
+	t.lock.Lock()
+	f, found := t.flows[key]
+	if !found {
+		f = &Flow{
+			ID:     len(t.order) + 1,
+			Key:    key,
+			Client: src,
+			Server: key.B,
+			Origin: capture.Origin(packet),
+		}
+		if src == key.B {
+			f.Server = key.A
+		}
+		t.flows[key] = f
+		t.order = append(t.order, f)
+	}
+	t.lock.Unlock()
+
+	// Count the bytes on the wire, or the captured bytes if the length is unknown
+	length := packet.Metadata().Length
+	if length == 0 {
+		length = len(packet.Data())
+	}
+	f.add(src == f.Client, length, packet.Metadata().Timestamp)
+
+	return f
+}
+
+// Lookup returns the flow of the given packet, or nil if there is none
+func (t *Table) Lookup(packet gopacket.Packet) *Flow {
+	key, _, ok := KeyOf(packet)
+	if !ok {
+		return nil
+	}
+	return t.Get(key)
+}
+
+// Get returns the flow with the given key, or nil if there is none
+func (t *Table) Get(key Key) *Flow {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.flows[key]
+}
+
+// Flows returns all flows, in order of their first packet
+func (t *Table) Flows() []*Flow {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return append([]*Flow(nil), t.order...)
+}
+
+// Counts a packet sent in the given direction
+func (f *Flow) add(fromClient bool, length int, timestamp time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if fromClient {
+		f.stats.ClientToServer.Packets++
+		f.stats.ClientToServer.Bytes += length
+	} else {
+		f.stats.ServerToClient.Packets++
+		f.stats.ServerToClient.Bytes += length
+	}
+
+	if f.stats.Start.IsZero() || timestamp.Before(f.stats.Start) {
+		f.stats.Start = timestamp
+	}
+	if timestamp.After(f.stats.End) {
+		f.stats.End = timestamp
+	}
+}
+
+// Stats returns the packets and bytes sent in the flow so far
+func (f *Flow) Stats() Stats {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.stats
+}
+
+// Annotate attaches the given information to the flow, e.g. "http.host". Names should be prefixed with the module name.
+func (f *Flow) Annotate(name string, value string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.annotations == nil {
+		f.annotations = make(map[string]string)
+	}
+	f.annotations[name] = value
+}
+
+// Annotation returns the information attached with the given name, or an empty string
+func (f *Flow) Annotation(name string) string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.annotations[name]
+}
+
+// Annotations returns all information attached to the flow, formatted as "name=value" and sorted by name
+func (f *Flow) Annotations() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var annotations []string
+	for name, value := range f.annotations {
+		annotations = append(annotations, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(annotations)
+	return annotations
+}
+
+// Service returns the protocol and server port of the flow, e.g. "TCP/80"
+func (f *Flow) Service() string {
+	if f.Server.Port == 0 {
+		return f.Key.Protocol.String()
+	}
+	return fmt.Sprintf("%s/%d", f.Key.Protocol, f.Server.Port)
+}
+
+// String returns the flow in a human-readable way, e.g. "#3 TCP 10.0.0.1:40000 -> 10.0.0.2:80"
+func (f *Flow) String() string {
+	return fmt.Sprintf("#%d %s %s -> %s", f.ID, f.Key.Protocol, f.Client, f.Server)
+}
+
+// String returns the endpoint as address and port, with brackets around IPv6 addresses
+func (e Endpoint) String() string {
+	if e.Port == 0 {
+		return e.Address
+	}
+	for _, c := range e.Address {
+		if c == ':' {
+			return fmt.Sprintf("[%s]:%d", e.Address, e.Port)
+		}
+	}
+	return fmt.Sprintf("%s:%d", e.Address, e.Port)
+}
+
+// Checks if the endpoint sorts before the other endpoint
+func (e Endpoint) less(other Endpoint) bool {
+	if e.Address != other.Address {
+		return e.Address < other.Address
+	}
+	return e.Port < other.Port
+}
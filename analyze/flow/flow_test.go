@@ -0,0 +1,109 @@
+package flow
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Returns a decoded ethernet frame carrying a TCP segment between the given endpoints
+func tcpPacket(t *testing.T, src Endpoint, dst Endpoint, timestamp time.Time, payload []byte) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP(src.Address), DstIP: net.ParseIP(dst.Address)}
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(src.Port), DstPort: layers.TCPPort(dst.Port), ACK: true, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	ethernet := &layers.Ethernet{SrcMAC: net.HardwareAddr{2, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{2, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4}
+	if serializeErr := gopacket.SerializeLayers(buffer, options, ethernet, ip, tcp, gopacket.Payload(payload)); serializeErr != nil {
+		t.Fatal(serializeErr)
+	}
+
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	packet.Metadata().Timestamp = timestamp
+	packet.Metadata().Length = len(buffer.Bytes())
+	return packet
+}
+
+func TestTableAdd(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	client := Endpoint{Address: "10.0.0.2", Port: 40000}
+	server := Endpoint{Address: "10.0.0.1", Port: 80}
+	other := Endpoint{Address: "10.0.0.3", Port: 40001}
+
+	table := NewTable()
+	first := table.Add(tcpPacket(t, client, server, start.Add(time.Second), []byte("GET / HTTP/1.0\r\n\r\n")))
+	second := table.Add(tcpPacket(t, server, client, start.Add(2*time.Second), []byte("HTTP/1.0 200 OK\r\n\r\n")))
+	third := table.Add(tcpPacket(t, other, server, start, nil))
+	table.Add(tcpPacket(t, client, server, start.Add(3*time.Second), nil))
+
+	// Both directions belong to the same flow, with the sender of the first packet as client
+	if first != second {
+		t.Fatalf("got different flows for both directions of a connection")
+	}
+	if first.ID != 1 || third.ID != 2 {
+		t.Errorf("got IDs %d and %d, expected 1 and 2", first.ID, third.ID)
+	}
+	if first.Client != client || first.Server != server {
+		t.Errorf("got %s, expected client %s and server %s", first, client, server)
+	}
+	if first.Key != NewKey(layers.IPProtocolTCP, server, client) {
+		t.Errorf("got key %v, expected the same key regardless of the direction", first.Key)
+	}
+	if first.Service() != "TCP/80" {
+		t.Errorf("got service %s, expected TCP/80", first.Service())
+	}
+
+	stats := first.Stats()
+	if stats.ClientToServer.Packets != 2 || stats.ServerToClient.Packets != 1 {
+		t.Errorf("got %d packets from the client and %d from the server, expected 2 and 1", stats.ClientToServer.Packets, stats.ServerToClient.Packets)
+	}
+	if stats.ClientToServer.Bytes <= stats.ServerToClient.Bytes || stats.ServerToClient.Bytes == 0 {
+		t.Errorf("got %d bytes from the client and %d from the server", stats.ClientToServer.Bytes, stats.ServerToClient.Bytes)
+	}
+	if !stats.Start.Equal(start.Add(time.Second)) || !stats.End.Equal(start.Add(3*time.Second)) {
+		t.Errorf("got flow from %s to %s", stats.Start, stats.End)
+	}
+
+	// Flows are listed in order of their first packet, and can be looked up by any of their packets
+	flows := table.Flows()
+	if len(flows) != 2 || flows[0] != first || flows[1] != third {
+		t.Errorf("got flows %v, expected %s and %s", flows, first, third)
+	}
+	if table.Lookup(tcpPacket(t, server, client, start, nil)) != first {
+		t.Errorf("lookup didn't return the flow of the packet")
+	}
+	if table.Get(NewKey(layers.IPProtocolUDP, client, server)) != nil {
+		t.Errorf("got a flow for a key never seen")
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	f := &Flow{}
+	f.Annotate("http.host", "example.com")
+	f.Annotate("dns.name", "example.org")
+	f.Annotate("http.host", "example.net")
+
+	if host := f.Annotation("http.host"); host != "example.net" {
+		t.Errorf("got annotation %s, expected the latest value example.net", host)
+	}
+	if annotations := f.Annotations(); len(annotations) != 2 || annotations[0] != "dns.name=example.org" || annotations[1] != "http.host=example.net" {
+		t.Errorf("got annotations %v", annotations)
+	}
+}
+
+func TestEndpointString(t *testing.T) {
+	tests := map[Endpoint]string{
+		{Address: "10.0.0.1", Port: 80}:    "10.0.0.1:80",
+		{Address: "10.0.0.1"}:              "10.0.0.1",
+		{Address: "2001:db8::1", Port: 53}: "[2001:db8::1]:53",
+	}
+	for e, expected := range tests {
+		if e.String() != expected {
+			t.Errorf("got %s, expected %s", e, expected)
+		}
+	}
+}
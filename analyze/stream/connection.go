@@ -0,0 +1,120 @@
+package stream
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+	"github.com/maride/pancap/analyze/flow"
+)
+
+// Creates a connection for every new TCP connection seen by the assembler
+type factory struct {
+	service *Service
+}
+
+// A single TCP connection, handed over to subscribers once its first data arrives
+type connection struct {
+	service        *Service
+	index          int
+	net, transport gopacket.Flow
+	flow           *flow.Flow
+
+	// Whether the first data was seen, and the connections handed over to the subscribers
+	started bool
+	conns   []*Conn
+	dump    *dump
+}
+
+// Creates a new connection, with the sender of the first packet as client
+func (f *factory) New(net, transport gopacket.Flow, tcp *layers.TCP, ac reassembly.AssemblerContext) reassembly.Stream {
+	f.service.connections++
+
+	var fl *flow.Flow
+	if f.service.flows != nil {
+		fl = f.service.flows.Get(flow.KeyFromFlows(net, transport))
+	}
+
+	return &connection{
+		service:   f.service,
+		index:     f.service.connections,
+		net:       net,
+		transport: transport,
+		flow:      fl,
+	}
+}
+
+// Accepts all packets, and starts reassembly even if the handshake wasn't captured
+func (c *connection) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo, dir reassembly.TCPFlowDirection, nextSeq reassembly.Sequence, start *bool, ac reassembly.AssemblerContext) bool {
+	*start = true
+	return true
+}
+
+// Hands the reassembled data over to the subscribers and the dump
+func (c *connection) ReassembledSG(sg reassembly.ScatterGather, ac reassembly.AssemblerContext) {
+	dir, _, _, skip := sg.Info()
+	length, _ := sg.Lengths()
+	if skip > 0 {
+		c.service.lostBytes += skip
+	}
+	if length == 0 {
+		return
+	}
+
+	// The scatter gather is reused, so the data needs to be copied
+	data := append([]byte(nil), sg.Fetch(length)...)
+	fromClient := dir == reassembly.TCPDirClientToServer
+
+	// Check who is interested in this connection on its first data
+	if !c.started {
+		c.start(data, fromClient)
+	}
+
+	for _, conn := range c.conns {
+		if fromClient {
+			conn.Client.write(data)
+		} else {
+			conn.Server.write(data)
+		}
+	}
+	c.dump.write(data, fromClient)
+}
+
+// Closes the readers of all subscribers, and the dump
+func (c *connection) ReassemblyComplete(ac reassembly.AssemblerContext) bool {
+	for _, conn := range c.conns {
+		conn.Client.close()
+		conn.Server.close()
+	}
+	c.dump.close()
+	return true
+}
+
+// Hands the connection over to all interested subscribers, and starts dumping it
+func (c *connection) start(data []byte, fromClient bool) {
+	c.started = true
+
+	for _, sub := range c.service.match(c.transport, data, fromClient) {
+		conn := &Conn{
+			Flow:      c.flow,
+			Net:       c.net,
+			Transport: c.transport,
+			Client:    newReader(),
+			Server:    newReader(),
+		}
+		c.conns = append(c.conns, conn)
+		sub.Handle(conn)
+	}
+
+	if c.service.dumpDirectory != "" {
+		id := c.index
+		if c.flow != nil {
+			id = c.flow.ID
+		}
+		client := flow.Endpoint{Address: c.net.Src().String(), Port: flow.Port(c.transport.Src())}
+		server := flow.Endpoint{Address: c.net.Dst().String(), Port: flow.Port(c.transport.Dst())}
+		c.dump = newDump(c.service.dumps, c.service.dumpDirectory, dumpName(id, "tcp", client, server, 1))
+		if c.dump != nil {
+			c.service.dumped++
+		}
+	}
+}
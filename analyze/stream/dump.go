@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/maride/pancap/analyze/flow"
+)
+
+// Maximum amount of dumps with open files, each of them holding three files
+const maxOpenDumps = 32
+
+// Files of a dump
+const (
+	dumpClient = iota
+	dumpServer
+	dumpCombined
+)
+
+// Writes a stream to files like Wireshark's "Follow TCP Stream":
+// the data sent by the client, the data sent by the server, and both in the order they were sent.
+// There may be thousands of streams at the same time, so only the files of recently written dumps are kept open.
+type dump struct {
+	name      string
+	filenames [3]string
+	// Open files, nil while the dump is closed
+	files []*os.File
+	// Position in the cache while the files are open
+	element *list.Element
+	cache   *dumpCache
+	// Set once writing failed, the rest of the stream is skipped then
+	failed bool
+}
+
+// Keeps the files of the most recently written dumps open
+type dumpCache struct {
+	// Dumps with open files, most recently written first
+	open *list.List
+}
+
+// Creates an empty cache
+func newDumpCache() *dumpCache {
+	return &dumpCache{open: list.New()}
+}
+
+// Creates the empty dump files with the given name in directory. Returns nil if they can't be created.
+func newDump(cache *dumpCache, directory string, name string) *dump {
+	if mkdirErr := os.MkdirAll(directory, 0755); mkdirErr != nil {
+		log.Printf("Unable to create directory %s to dump streams to: %s", directory, mkdirErr.Error())
+		return nil
+	}
+
+	base := filepath.Join(directory, name)
+	d := &dump{
+		name:      name,
+		filenames: [3]string{base + "-client.bin", base + "-server.bin", base + "-combined.bin"},
+		cache:     cache,
+	}
+	if openErr := cache.openFiles(d, os.O_WRONLY|os.O_CREATE|os.O_TRUNC); openErr != nil {
+		log.Printf("Unable to dump stream %s: %s", name, openErr.Error())
+		return nil
+	}
+	return d
+}
+
+// Returns the name of the dump of a stream, starting with the ID of its flow, so it matches the flows named in the report.
+// If a flow is split into several streams, part counts them.
+func dumpName(id int, protocol string, client flow.Endpoint, server flow.Endpoint, part int) string {
+	name := fmt.Sprintf("%04d-%s-%s_%d-%s_%d", id, protocol, client.Address, client.Port, server.Address, server.Port)
+	if part > 1 {
+		name += fmt.Sprintf("-%d", part)
+	}
+
+	// IPv6 addresses contain colons, which are not allowed in file names on every system
+	return strings.Replace(name, ":", ".", -1)
+}
+
+// Writes data sent in the given direction
+func (d *dump) write(data []byte, fromClient bool) {
+	if d == nil || d.failed {
+		return
+	}
+
+	if openErr := d.cache.openFiles(d, os.O_WRONLY|os.O_APPEND); openErr != nil {
+		d.fail(openErr)
+		return
+	}
+	target := d.files[dumpServer]
+	if fromClient {
+		target = d.files[dumpClient]
+	}
+	for _, file := range []*os.File{target, d.files[dumpCombined]} {
+		if _, writeErr := file.Write(data); writeErr != nil {
+			d.fail(writeErr)
+			return
+		}
+	}
+}
+
+// Notes that writing the dump failed, logging the error once for the stream
+func (d *dump) fail(err error) {
+	log.Printf("Unable to dump stream %s, skipping the rest of it: %s", d.name, err.Error())
+	d.failed = true
+	d.close()
+}
+
+// Closes the files of the dump, they are opened again if further data is written
+func (d *dump) close() {
+	if d == nil || d.files == nil {
+		return
+	}
+	for _, file := range d.files {
+		file.Close()
+	}
+	d.files = nil
+	d.cache.open.Remove(d.element)
+	d.element = nil
+}
+
+// Opens the files of the given dump with the given flags if they are closed, and marks it as the most recently written one.
+// If too many dumps are open, the files of the least recently written one are closed.
+func (c *dumpCache) openFiles(d *dump, flags int) error {
+	if d.files != nil {
+		c.open.MoveToFront(d.element)
+		return nil
+	}
+	if c.open.Len() >= maxOpenDumps {
+		c.open.Back().Value.(*dump).close()
+	}
+
+	files := make([]*os.File, 0, len(d.filenames))
+	for _, filename := range d.filenames {
+		file, openErr := os.OpenFile(filename, flags, 0644)
+		if openErr != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return openErr
+		}
+		files = append(files, file)
+	}
+	d.files = files
+	d.element = c.open.PushFront(d)
+	return nil
+}
+
+// Closes the files of all dumps
+func (c *dumpCache) closeAll() {
+	for c.open.Len() > 0 {
+		c.open.Front().Value.(*dump).close()
+	}
+}
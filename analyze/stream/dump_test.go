@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDumpCache(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "pancap-dumps")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	// Write to way more dumps than are kept open, in turns, so their files are closed and opened again
+	cache := newDumpCache()
+	dumps := make([]*dump, 3*maxOpenDumps)
+	for i := range dumps {
+		dumps[i] = newDump(cache, dir, fmt.Sprintf("dump%d", i))
+		if dumps[i] == nil {
+			t.Fatalf("dump %d wasn't created", i)
+		}
+	}
+	for round := 0; round < 3; round++ {
+		for i, d := range dumps {
+			d.write([]byte(fmt.Sprintf("c%d%d", i, round)), true)
+			d.write([]byte(fmt.Sprintf("s%d%d", i, round)), false)
+			if cache.open.Len() > maxOpenDumps {
+				t.Fatalf("got %d open dumps, expected at most %d", cache.open.Len(), maxOpenDumps)
+			}
+		}
+	}
+	cache.closeAll()
+	if cache.open.Len() != 0 {
+		t.Errorf("got %d open dumps after closing all of them", cache.open.Len())
+	}
+
+	for i := range dumps {
+		var client, server, combined []string
+		for round := 0; round < 3; round++ {
+			c, s := fmt.Sprintf("c%d%d", i, round), fmt.Sprintf("s%d%d", i, round)
+			client, server, combined = append(client, c), append(server, s), append(combined, c, s)
+		}
+		base := filepath.Join(dir, fmt.Sprintf("dump%d", i))
+		for suffix, expected := range map[string][]string{"-client.bin": client, "-server.bin": server, "-combined.bin": combined} {
+			if content := readDump(t, base+suffix); content != strings.Join(expected, "") {
+				t.Errorf("got %q in %s, expected %q", content, base+suffix, strings.Join(expected, ""))
+			}
+		}
+	}
+}
+
+func TestDumpFailure(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "pancap-dumps")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	// Files removed while the dump is closed are not created again, the rest of the stream is skipped instead
+	cache := newDumpCache()
+	d := newDump(cache, dir, "gone")
+	d.close()
+	os.Remove(filepath.Join(dir, "gone-client.bin"))
+	d.write([]byte("lost"), true)
+	d.write([]byte("lost"), false)
+	if !d.failed || d.files != nil || cache.open.Len() != 0 {
+		t.Errorf("got failed %t with %d open dumps, expected the dump to be failed and closed", d.failed, cache.open.Len())
+	}
+	if content := readDump(t, filepath.Join(dir, "gone-combined.bin")); content != "" {
+		t.Errorf("got %q in the combined dump, expected nothing", content)
+	}
+}
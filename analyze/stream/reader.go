@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"io"
+	"sync"
+)
+
+// Amount of chunks buffered for a reader before the service blocks
+const readerBuffer = 16
+
+// Reader reads one direction of a reassembled connection.
+// The service blocks while the buffer of a reader is full, so readers must be read until EOF, or closed.
+type Reader struct {
+	chunks  chan []byte
+	current []byte
+
+	// Closed by the subscriber if it isn't interested in further data
+	done      chan struct{}
+	closeDone sync.Once
+	closed    bool
+}
+
+// Creates a new, empty reader
+func newReader() *Reader {
+	return &Reader{
+		chunks: make(chan []byte, readerBuffer),
+		done:   make(chan struct{}),
+	}
+}
+
+// Read reads the next data of the connection, returning io.EOF after the connection is closed
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		chunk, ok := <-r.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		r.current = chunk
+	}
+
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// Close drops all further data of the connection, so the reader doesn't need to be read until EOF
+func (r *Reader) Close() error {
+	r.closeDone.Do(func() {
+		close(r.done)
+	})
+	return nil
+}
+
+// Hands over data to the reader, dropping it if the reader was closed
+func (r *Reader) write(data []byte) {
+	if r.closed {
+		return
+	}
+	select {
+	case r.chunks <- data:
+	case <-r.done:
+	}
+}
+
+// Lets the reader run into EOF after the remaining data is read. Called by the service only.
+func (r *Reader) close() {
+	if !r.closed {
+		r.closed = true
+		close(r.chunks)
+	}
+}
@@ -0,0 +1,173 @@
+// Package stream reassembles TCP connections once for all modules, and groups UDP datagrams into pseudo-streams.
+//
+// Modules subscribe to connections by port or by a heuristic on the first data of a connection,
+// and get the reassembled client and server byte streams as readers.
+// Gaps, retransmissions and out-of-order segments are handled by the reassembly,
+// so subscribers only see the payload in order, with lost data left out.
+// If a dump directory is given, all TCP connections and UDP pseudo-streams are written to files there.
+package stream
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+	"github.com/maride/pancap/analyze/flow"
+	"github.com/maride/pancap/output"
+)
+
+const (
+	// Interval in capture time in which connections are checked for inactivity
+	flushInterval = time.Minute
+	// Connections without packets for this long (in capture time) are closed
+	flushTimeout = 2 * time.Minute
+)
+
+// Subscription describes which connections a module is interested in
+type Subscription struct {
+	// Connections using one of these ports on either side are handed over
+	Ports []uint16
+	// Optional heuristic to detect further connections, called with the first data of a connection and its direction
+	Detect func(data []byte, fromClient bool) bool
+	// Called for every matching connection, on the goroutine of the service.
+	// Both readers of the connection must be read until EOF, typically on goroutines started here.
+	Handle func(conn *Conn)
+}
+
+// Conn is a reassembled TCP connection as seen by a subscriber
+type Conn struct {
+	// Flow of the connection in the flow table, may be nil if the flow is unknown
+	Flow *flow.Flow
+	// Network and transport flow in client to server direction
+	Net       gopacket.Flow
+	Transport gopacket.Flow
+	// Data sent by the client and by the server
+	Client *Reader
+	Server *Reader
+}
+
+// Service reassembles all TCP connections and hands them over to subscribers.
+// Packets must be handed over from a single goroutine.
+type Service struct {
+	flows         *flow.Table
+	subscriptions []Subscription
+	dumpDirectory string
+
+	assembler *reassembly.Assembler
+	datagrams map[flow.Key]*datagramConversation
+	dumps     *dumpCache
+	lastFlush time.Time
+
+	// Statistics shown in the summary
+	connections           int
+	lostBytes             int
+	dumped                int
+	datagramConversations int
+	dumpedDatagramStreams int
+}
+
+// Creates a new stream service, looking up connections in the given flow table.
+// If dumpDirectory is given, all connections are written to files in it.
+func NewService(flows *flow.Table, dumpDirectory string) *Service {
+	s := &Service{
+		flows:         flows,
+		dumpDirectory: dumpDirectory,
+		datagrams:     make(map[flow.Key]*datagramConversation),
+		dumps:         newDumpCache(),
+	}
+	s.assembler = reassembly.NewAssembler(reassembly.NewStreamPool(&factory{service: s}))
+	return s
+}
+
+// Subscribe hands over all connections matching the given subscription. Must be called before packets are added.
+func (s *Service) Subscribe(subscription Subscription) {
+	s.subscriptions = append(s.subscriptions, subscription)
+}
+
+// Active returns true if anyone is interested in reassembled connections at all
+func (s *Service) Active() bool {
+	return s != nil && (len(s.subscriptions) > 0 || s.dumpDirectory != "")
+}
+
+// Add reassembles the given packet if it is a TCP packet, or adds it to its pseudo-stream if it is a UDP packet
+func (s *Service) Add(packet gopacket.Packet) {
+	if packet.NetworkLayer() == nil {
+		return
+	}
+
+	timestamp := packet.Metadata().Timestamp
+	if s.lastFlush.IsZero() {
+		s.lastFlush = timestamp
+	}
+
+	switch t := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		s.assembler.AssembleWithContext(packet.NetworkLayer().NetworkFlow(), t, &context{packet.Metadata().CaptureInfo})
+	case *layers.UDP:
+		s.addDatagram(packet, t)
+	default:
+		return
+	}
+
+	// Check if we should close inactive connections, to keep memory usage in check
+	if timestamp.Sub(s.lastFlush) > flushInterval {
+		s.assembler.FlushCloseOlderThan(timestamp.Add(-flushTimeout))
+		s.lastFlush = timestamp
+	}
+}
+
+// Close closes all remaining connections, which lets the readers of the subscribers run into EOF, and all dump files
+func (s *Service) Close() {
+	s.assembler.FlushAll()
+	s.dumps.closeAll()
+}
+
+// Summary returns a block about the reassembled connections and pseudo-streams
+func (s *Service) Summary() output.Block {
+	block := output.Block{Headline: "Streams"}
+	block.Add(output.Count{Name: "streams", Value: s.connections, Label: "TCP streams reassembled"})
+	if s.lostBytes > 0 {
+		block.Add(output.Text{Line: fmt.Sprintf("%d bytes were lost in gaps, e.g. because packets were not captured", s.lostBytes)})
+	}
+	if s.dumpDirectory != "" {
+		block.Add(
+			output.Count{Name: "udpConversations", Value: s.datagramConversations, Label: "UDP conversations"},
+			output.Text{Line: fmt.Sprintf("Wrote %d TCP streams and %d UDP pseudo-streams to %s", s.dumped, s.dumpedDatagramStreams, s.dumpDirectory)},
+		)
+	}
+	return block
+}
+
+// Returns the subscriptions interested in the connection with the given transport flow, with data being its first data
+func (s *Service) match(transport gopacket.Flow, data []byte, fromClient bool) []Subscription {
+	src, dst := flow.Port(transport.Src()), flow.Port(transport.Dst())
+
+	var matched []Subscription
+	for _, sub := range s.subscriptions {
+		if containsPort(sub.Ports, src) || containsPort(sub.Ports, dst) || (sub.Detect != nil && sub.Detect(data, fromClient)) {
+			matched = append(matched, sub)
+		}
+	}
+	return matched
+}
+
+// Checks if ports contains the given port
+func containsPort(ports []uint16, port uint16) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Hands over the capture info of a packet to the assembler
+type context struct {
+	ci gopacket.CaptureInfo
+}
+
+func (c *context) GetCaptureInfo() gopacket.CaptureInfo {
+	return c.ci
+}
@@ -0,0 +1,176 @@
+package stream
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/analyze/flow"
+)
+
+var (
+	clientIP = net.IP{10, 0, 0, 2}
+	serverIP = net.IP{10, 0, 0, 1}
+	start    = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// Returns a decoded IPv4 packet carrying the given transport layer and payload, captured at the given offset from start
+func packet(t *testing.T, fromClient bool, transport gopacket.SerializableLayer, payload []byte, offset time.Duration) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: clientIP, DstIP: serverIP}
+	if !fromClient {
+		ip.SrcIP, ip.DstIP = serverIP, clientIP
+	}
+	switch v := transport.(type) {
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		v.SetNetworkLayerForChecksum(ip)
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		v.SetNetworkLayerForChecksum(ip)
+	}
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if serializeErr := gopacket.SerializeLayers(buffer, options, ip, transport, gopacket.Payload(payload)); serializeErr != nil {
+		t.Fatal(serializeErr)
+	}
+
+	p := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	p.Metadata().Timestamp = start.Add(offset)
+	p.Metadata().CaptureLength = len(buffer.Bytes())
+	p.Metadata().Length = len(buffer.Bytes())
+	return p
+}
+
+// Returns a TCP segment of the connection between port 40000 of the client and port 80 of the server
+func segment(t *testing.T, fromClient bool, seq uint32, flags string, payload string, offset time.Duration) gopacket.Packet {
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: 80, Seq: seq, Window: 1024}
+	if !fromClient {
+		tcp.SrcPort, tcp.DstPort = 80, 40000
+	}
+	for _, f := range flags {
+		switch f {
+		case 'S':
+			tcp.SYN = true
+		case 'A':
+			tcp.ACK = true
+		case 'F':
+			tcp.FIN = true
+		}
+	}
+	return packet(t, fromClient, tcp, []byte(payload), offset)
+}
+
+// Reads the given dump file
+func readDump(t *testing.T, filename string) string {
+	data, readErr := ioutil.ReadFile(filename)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	return string(data)
+}
+
+func TestReassembly(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "pancap-streams")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	// Subscribe to HTTP, reading both directions until EOF
+	var wg sync.WaitGroup
+	var client, server []byte
+	var conns int
+	s := NewService(nil, dir)
+	s.Subscribe(Subscription{
+		Ports: []uint16{80},
+		Handle: func(conn *Conn) {
+			conns++
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				client, _ = ioutil.ReadAll(conn.Client)
+			}()
+			go func() {
+				defer wg.Done()
+				server, _ = ioutil.ReadAll(conn.Server)
+			}()
+		},
+	})
+	if !s.Active() {
+		t.Fatal("service with subscription and dump directory is not active")
+	}
+
+	// A connection with a retransmitted and a reordered segment
+	packets := []gopacket.Packet{
+		segment(t, true, 1000, "S", "", 0),
+		segment(t, false, 5000, "SA", "", time.Millisecond),
+		segment(t, true, 1001, "A", "", 2*time.Millisecond),
+		segment(t, true, 1001, "A", "GET / ", 3*time.Millisecond),
+		segment(t, true, 1015, "A", "\r\n\r\n", 4*time.Millisecond),
+		segment(t, true, 1007, "A", "HTTP/1.0", 5*time.Millisecond),
+		segment(t, true, 1007, "A", "HTTP/1.0", 6*time.Millisecond),
+		segment(t, false, 5001, "A", "HTTP/1.0 200 OK\r\n\r\nhello", 7*time.Millisecond),
+		segment(t, false, 5025, "FA", "", 8*time.Millisecond),
+		segment(t, true, 1019, "FA", "", 9*time.Millisecond),
+	}
+	for _, p := range packets {
+		s.Add(p)
+	}
+	s.Close()
+	wg.Wait()
+
+	if conns != 1 {
+		t.Fatalf("got %d connections handed over, expected 1", conns)
+	}
+	if string(client) != "GET / HTTP/1.0\r\n\r\n" {
+		t.Errorf("got client data %q", client)
+	}
+	if string(server) != "HTTP/1.0 200 OK\r\n\r\nhello" {
+		t.Errorf("got server data %q", server)
+	}
+
+	// The dump is named after the connection, as there is no flow table
+	base := filepath.Join(dir, "0001-tcp-10.0.0.2_40000-10.0.0.1_80")
+	if dump := readDump(t, base+"-client.bin"); dump != string(client) {
+		t.Errorf("got client dump %q", dump)
+	}
+	if dump := readDump(t, base+"-server.bin"); dump != string(server) {
+		t.Errorf("got server dump %q", dump)
+	}
+	if dump := readDump(t, base+"-combined.bin"); dump != string(client)+string(server) {
+		t.Errorf("got combined dump %q", dump)
+	}
+	if s.connections != 1 || s.dumped != 1 || s.lostBytes != 0 {
+		t.Errorf("got %d connections, %d dumped and %d bytes lost", s.connections, s.dumped, s.lostBytes)
+	}
+}
+
+func TestSubscriptionDetect(t *testing.T) {
+	var matched []uint16
+	s := NewService(nil, "")
+	s.Subscribe(Subscription{
+		Detect: func(data []byte, fromClient bool) bool {
+			return fromClient && string(data) == "hello"
+		},
+		Handle: func(conn *Conn) {
+			matched = append(matched, flow.Port(conn.Transport.Dst()))
+			conn.Client.Close()
+			conn.Server.Close()
+		},
+	})
+
+	s.Add(segment(t, true, 1000, "S", "", 0))
+	s.Add(segment(t, true, 1001, "A", "hello", time.Millisecond))
+	s.Close()
+
+	if len(matched) != 1 || matched[0] != 80 {
+		t.Errorf("got connections to ports %v, expected a single one to port 80", matched)
+	}
+}
@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/analyze/flow"
+)
+
+// UDP datagrams of the same 5-tuple belong to the same pseudo-stream, unless there was no datagram for this long (in capture time)
+const udpTimeout = 30 * time.Second
+
+// The datagrams of a UDP conversation, with the sender of the first datagram as client
+type datagramStream struct {
+	client flow.Endpoint
+	last   time.Time
+	dump   *dump
+}
+
+// A UDP conversation, which is split into several pseudo-streams if it pauses longer than udpTimeout
+type datagramConversation struct {
+	id     int
+	parts  int
+	stream *datagramStream
+}
+
+// Adds the payload of the given UDP datagram to its pseudo-stream, starting a new one if necessary.
+// Pseudo-streams are only written to files, so nothing needs to be done unless streams are dumped.
+func (s *Service) addDatagram(packet gopacket.Packet, udp *layers.UDP) {
+	if s.dumpDirectory == "" {
+		return
+	}
+
+	key, src, ok := flow.KeyOf(packet)
+	if !ok {
+		return
+	}
+	timestamp := packet.Metadata().Timestamp
+
+	// Look up the conversation, naming it after its flow
+	c, found := s.datagrams[key]
+	if !found {
+		s.datagramConversations++
+		c = &datagramConversation{id: s.datagramConversations}
+		if s.flows != nil {
+			if f := s.flows.Get(key); f != nil {
+				c.id = f.ID
+			}
+		}
+		s.datagrams[key] = c
+	}
+
+	// Start a new pseudo-stream if this is the first datagram, or if the conversation paused for too long
+	if c.stream != nil && timestamp.Sub(c.stream.last) > udpTimeout {
+		c.stream.dump.close()
+		c.stream = nil
+	}
+	if c.stream == nil {
+		c.parts++
+		server := key.B
+		if src == key.B {
+			server = key.A
+		}
+		c.stream = &datagramStream{
+			client: src,
+			dump:   newDump(s.dumps, s.dumpDirectory, dumpName(c.id, "udp", src, server, c.parts)),
+		}
+		if c.stream.dump != nil {
+			s.dumpedDatagramStreams++
+		}
+	}
+
+	c.stream.last = timestamp
+	if len(udp.Payload) > 0 {
+		c.stream.dump.write(udp.Payload, src == c.stream.client)
+	}
+}
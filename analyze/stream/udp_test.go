@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestDatagramStreams(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "pancap-streams")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewService(nil, dir)
+	datagram := func(fromClient bool, payload string, offset time.Duration) {
+		udp := &layers.UDP{SrcPort: 5353, DstPort: 53}
+		if !fromClient {
+			udp.SrcPort, udp.DstPort = 53, 5353
+		}
+		s.Add(packet(t, fromClient, udp, []byte(payload), offset))
+	}
+
+	// A conversation pausing longer than the timeout is split into two pseudo-streams
+	datagram(true, "ping", 0)
+	datagram(false, "pong", time.Second)
+	datagram(true, "again", time.Second+udpTimeout+time.Millisecond)
+	if s.dumps.open.Len() != 1 {
+		t.Errorf("got %d open dumps, expected the files of the first pseudo-stream to be closed", s.dumps.open.Len())
+	}
+	s.Close()
+
+	first := filepath.Join(dir, "0001-udp-10.0.0.2_5353-10.0.0.1_53")
+	second := first + "-2"
+	expected := map[string]string{
+		first + "-client.bin":    "ping",
+		first + "-server.bin":    "pong",
+		first + "-combined.bin":  "pingpong",
+		second + "-client.bin":   "again",
+		second + "-server.bin":   "",
+		second + "-combined.bin": "again",
+	}
+	for filename, content := range expected {
+		if dump := readDump(t, filename); dump != content {
+			t.Errorf("got %q in %s, expected %q", dump, filename, content)
+		}
+	}
+	if s.datagramConversations != 1 || s.dumpedDatagramStreams != 2 {
+		t.Errorf("got %d conversations and %d pseudo-streams, expected 1 and 2", s.datagramConversations, s.dumpedDatagramStreams)
+	}
+}
+
+func TestManyDatagramStreams(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "pancap-streams")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	// Way more concurrent pseudo-streams than there would be file descriptors if the dumps kept their files open,
+	// each of them answered after all queries were sent, so their files are opened again
+	const conversations = 1000
+	s := NewService(nil, dir)
+	for i := 0; i < 2*conversations; i++ {
+		udp := &layers.UDP{SrcPort: layers.UDPPort(10000 + i%conversations), DstPort: 53}
+		payload := "query"
+		if i >= conversations {
+			udp.SrcPort, udp.DstPort = udp.DstPort, udp.SrcPort
+			payload = "response"
+		}
+		s.Add(packet(t, i < conversations, udp, []byte(payload), time.Duration(i)*time.Millisecond))
+		if s.dumps.open.Len() > maxOpenDumps {
+			t.Fatalf("got %d open dumps, expected at most %d", s.dumps.open.Len(), maxOpenDumps)
+		}
+	}
+	s.Close()
+
+	if s.dumpedDatagramStreams != conversations {
+		t.Errorf("got %d pseudo-streams dumped, expected %d", s.dumpedDatagramStreams, conversations)
+	}
+	last := filepath.Join(dir, fmt.Sprintf("%04d-udp-10.0.0.2_%d-10.0.0.1_53-combined.bin", conversations, 10000+conversations-1))
+	if dump := readDump(t, last); dump != "queryresponse" {
+		t.Errorf("got %q in the last pseudo-stream, expected \"queryresponse\"", dump)
+	}
+}
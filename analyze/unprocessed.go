@@ -0,0 +1,100 @@
+package analyze
+
+import (
+	"sort"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/output"
+)
+
+// Amount of ports listed in the breakdown of unprocessed packets
+const topPorts = 10
+
+// Keeps track of the packets no module processed, to show which protocols pancap doesn't understand yet
+type unprocessedStats struct {
+	// Amount of packets by their deepest decoded layer
+	layers map[string]int
+	// Amount of TCP and UDP packets by their port
+	ports map[string]int
+}
+
+// Creates empty statistics
+func newUnprocessedStats() unprocessedStats {
+	return unprocessedStats{
+		layers: make(map[string]int),
+		ports:  make(map[string]int),
+	}
+}
+
+// Adds the given packet to the statistics
+func (u *unprocessedStats) add(packet gopacket.Packet) {
+	u.layers[deepestLayer(packet)]++
+
+	// Count the lower of both ports, which usually is the one of the service
+	if tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP); ok {
+		port := tcp.SrcPort
+		if tcp.DstPort < port {
+			port = tcp.DstPort
+		}
+		u.ports["TCP "+port.String()]++
+	} else if udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+		port := udp.SrcPort
+		if udp.DstPort < port {
+			port = udp.DstPort
+		}
+		u.ports["UDP "+port.String()]++
+	}
+}
+
+// Returns the type of the deepest layer decoded in the given packet, ignoring undecoded payload
+func deepestLayer(packet gopacket.Packet) string {
+	packetLayers := packet.Layers()
+	for i := len(packetLayers) - 1; i >= 0; i-- {
+		t := packetLayers[i].LayerType()
+		if t != gopacket.LayerTypePayload && t != gopacket.LayerTypeDecodeFailure {
+			return t.String()
+		}
+	}
+	return "(none)"
+}
+
+// Returns the breakdown of the unprocessed packets as items for the overall statistics
+func (u *unprocessedStats) items() []output.Item {
+	layerTable := output.Table{
+		Title:   "Unprocessed packets by deepest layer",
+		Columns: []string{"Layer", "Packets"},
+	}
+	for _, l := range sortByCount(u.layers) {
+		layerTable.AddRow(l, u.layers[l])
+	}
+
+	portTable := output.Table{
+		Title:   "Top unprocessed TCP/UDP ports",
+		Columns: []string{"Port", "Packets"},
+	}
+	for i, p := range sortByCount(u.ports) {
+		if i == topPorts {
+			break
+		}
+		portTable.AddRow(p, u.ports[p])
+	}
+
+	return []output.Item{layerTable, portTable}
+}
+
+// Returns the keys of the given map, sorted by their value in descending order and by name
+func sortByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
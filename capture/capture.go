@@ -0,0 +1,59 @@
+// Package capture opens capture files for analysis.
+//
+// By default, captures are read with the pure-Go readers of gopacket, so pancap builds without cgo.
+// Building with the tag "libpcap" reads files with libpcap instead.
+// Compressed captures (gzip, bzip2, xz, zstd) and stdin are always read with the pure-Go readers.
+package capture
+
+import (
+	"io"
+	"os"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Opens the given capture file, returns its packets, the link type and a closer releasing the file or an error.
+// The filename "-" reads the capture from stdin.
+func Open(filename string) (*gopacket.PacketSource, layers.LinkType, io.Closer, error) {
+	dataSource, linkType, closer, openErr := open(filename, nil)
+	if openErr != nil {
+		// There were some problems opening the file
+		return nil, 0, nil, openErr
+	}
+
+	// Open given data source as packet source and return it
+	packetSource := gopacket.NewPacketSource(dataSource, decoder(linkType))
+	return packetSource, linkType, closer, nil
+}
+
+// Opens the given capture file or stdin, counting the bytes read with counter (if not nil)
+func open(filename string, counter *ReadCounter) (gopacket.PacketDataSource, layers.LinkType, io.Closer, error) {
+	if filename == "-" {
+		// Read from stdin, e.g. piped from tcpdump -w - or zcat
+		return openStream(counter.wrapReader(os.Stdin))
+	}
+
+	// Open specified file with the backend chosen at build time
+	return openFile(filename, counter)
+}
+
+// Several closers, closed in order. Returns the first error encountered.
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var firstErr error
+	for _, closer := range c {
+		if closeErr := closer.Close(); closeErr != nil && firstErr == nil {
+			firstErr = closeErr
+		}
+	}
+	return firstErr
+}
+
+// A function used as closer
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,75 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte{'B', 'Z', 'h'}
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Wraps the given reader into a decompressor if it starts with the magic bytes of a known compression format,
+// which are gzip, bzip2, xz and zstd.
+// Returns the reader to read the capture from, which needs to be closed to release the decompressor, and whether it is compressed.
+// Closing the returned reader doesn't close r.
+func decompress(r io.Reader) (io.ReadCloser, bool, error) {
+	buffered := bufio.NewReader(r)
+
+	// Peek at the magic bytes. Short reads are fine, the capture reader will complain about them.
+	magic, _ := buffered.Peek(6)
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, gzipErr := gzip.NewReader(buffered)
+		if gzipErr != nil {
+			return nil, true, gzipErr
+		}
+		return gzipReader, true, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return ioutil.NopCloser(bzip2.NewReader(buffered)), true, nil
+	case bytes.HasPrefix(magic, xzMagic):
+		xzReader, xzErr := xz.NewReader(buffered)
+		if xzErr != nil {
+			return nil, true, xzErr
+		}
+		return ioutil.NopCloser(xzReader), true, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zstdReader, zstdErr := zstd.NewReader(buffered)
+		if zstdErr != nil {
+			return nil, true, zstdErr
+		}
+		return zstdReader.IOReadCloser(), true, nil
+	}
+
+	// Not compressed (or at least not in a format we know)
+	return ioutil.NopCloser(buffered), false, nil
+}
+
+// Reads packets from the given, possibly compressed stream with the pure-Go readers.
+// The returned closer releases the decompressor, but doesn't close r.
+func openStream(r io.Reader) (gopacket.PacketDataSource, layers.LinkType, io.Closer, error) {
+	decompressed, _, decompressErr := decompress(r)
+	if decompressErr != nil {
+		return nil, 0, nil, decompressErr
+	}
+
+	source, linkType, readerErr := newReader(decompressed)
+	if readerErr != nil {
+		decompressed.Close()
+		return nil, 0, nil, readerErr
+	}
+	return source, linkType, decompressed, nil
+}
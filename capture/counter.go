@@ -0,0 +1,84 @@
+package capture
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/google/gopacket"
+)
+
+// Size of the record header preceding each packet in a pcap file
+const recordHeaderSize = 16
+
+// ReadCounter tracks how many bytes of the capture files were read so far, e.g. to report the progress.
+// It may be read while the files are read.
+type ReadCounter struct {
+	read int64
+	size int64
+}
+
+// BytesRead returns the amount of bytes read from the capture files so far
+func (c *ReadCounter) BytesRead() int64 {
+	return atomic.LoadInt64(&c.read)
+}
+
+// Size returns the total size of all capture files, or 0 if it is unknown, e.g. when reading from stdin
+func (c *ReadCounter) Size() int64 {
+	return atomic.LoadInt64(&c.size)
+}
+
+// Adds the size of the given file to the total size
+func (c *ReadCounter) addFile(file *os.File) {
+	if c == nil {
+		return
+	}
+
+	info, statErr := file.Stat()
+	if statErr == nil && info.Mode().IsRegular() {
+		atomic.AddInt64(&c.size, info.Size())
+	}
+}
+
+// Returns a reader counting all bytes read from r
+func (c *ReadCounter) wrapReader(r io.Reader) io.Reader {
+	if c == nil {
+		return r
+	}
+	return &countingReader{reader: r, counter: c}
+}
+
+// Returns a data source counting all packets read from source, along with their record headers.
+// Used for sources which read the file themselves, like libpcap.
+func (c *ReadCounter) wrapSource(source gopacket.PacketDataSource) gopacket.PacketDataSource {
+	if c == nil {
+		return source
+	}
+	return &countingSource{source: source, counter: c}
+}
+
+// A reader counting the bytes read through it
+type countingReader struct {
+	reader  io.Reader
+	counter *ReadCounter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	atomic.AddInt64(&r.counter.read, int64(n))
+	return n, err
+}
+
+// A data source counting the bytes of the packets read through it
+type countingSource struct {
+	source  gopacket.PacketDataSource
+	counter *ReadCounter
+}
+
+func (s *countingSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, ci, err := s.source.ReadPacketData()
+	if err == nil {
+		atomic.AddInt64(&s.counter.read, int64(ci.CaptureLength+recordHeaderSize))
+	}
+	return data, ci, err
+}
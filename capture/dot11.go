@@ -0,0 +1,30 @@
+package capture
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Returns the decoder for packets of the given link type.
+// gopacket expects raw 802.11 frames to end with a frame check sequence, but many captures come without it,
+// so they are decoded by decodeDot11 instead of replacing the decoder of gopacket for everyone.
+func decoder(linkType layers.LinkType) gopacket.Decoder {
+	if linkType == layers.LinkTypeIEEE802_11 {
+		return gopacket.DecodeFunc(decodeDot11)
+	}
+	return linkType
+}
+
+// Decodes a raw 802.11 frame, adding the frame check sequence if it's missing - as gopacket does for radiotap
+func decodeDot11(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) < 4 || crc32.ChecksumIEEE(data[:len(data)-4]) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		frame := make([]byte, len(data)+4)
+		copy(frame, data)
+		binary.LittleEndian.PutUint32(frame[len(data):], crc32.ChecksumIEEE(data))
+		data = frame
+	}
+	return layers.LayerTypeDot11.Decode(data, p)
+}
@@ -0,0 +1,43 @@
+package capture
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestDecodeDot11(t *testing.T) {
+	// Deauthentication frame, reason 7
+	frame := make([]byte, 26)
+	frame[0] = 0xc0
+	copy(frame[4:10], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(frame[10:16], []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})
+	copy(frame[16:22], []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})
+	frame[24] = 7
+	withFCS := make([]byte, len(frame)+4)
+	copy(withFCS, frame)
+	binary.LittleEndian.PutUint32(withFCS[len(frame):], crc32.ChecksumIEEE(frame))
+
+	for name, data := range map[string][]byte{"without FCS": frame, "with FCS": withFCS} {
+		packet := gopacket.NewPacket(data, decoder(layers.LinkTypeIEEE802_11), gopacket.Default)
+		deauth, ok := packet.Layer(layers.LayerTypeDot11MgmtDeauthentication).(*layers.Dot11MgmtDeauthentication)
+		if !ok {
+			t.Errorf("%s: got layers %v, expected a deauthentication frame", name, packet.Layers())
+			continue
+		}
+		if deauth.Reason != 7 {
+			t.Errorf("%s: got reason %d, expected 7", name, deauth.Reason)
+		}
+		if dot11 := packet.Layer(layers.LayerTypeDot11).(*layers.Dot11); !dot11.ChecksumValid() {
+			t.Errorf("%s: got invalid checksum", name)
+		}
+	}
+
+	// Other link types are decoded by gopacket
+	if decoder(layers.LinkTypeEthernet) != layers.LinkTypeEthernet {
+		t.Error("got a different decoder for ethernet")
+	}
+}
@@ -0,0 +1,56 @@
+//go:build libpcap
+// +build libpcap
+
+package capture
+
+import (
+	"io"
+	"os"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// Opens the given file with libpcap, or with the pure-Go readers if it is compressed.
+// The bytes read are counted with counter (if not nil). The returned closer closes the file.
+func openFile(filename string, counter *ReadCounter) (gopacket.PacketDataSource, layers.LinkType, io.Closer, error) {
+	file, openErr := os.Open(filename)
+	if openErr != nil {
+		return nil, 0, nil, openErr
+	}
+	counter.addFile(file)
+
+	// libpcap can't handle compressed files, leave them to the pure-Go readers
+	decompressed, compressed, decompressErr := decompress(file)
+	if decompressErr != nil {
+		file.Close()
+		return nil, 0, nil, decompressErr
+	}
+	decompressed.Close()
+	if compressed {
+		// Start over, this time counting the bytes read
+		if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+			file.Close()
+			return nil, 0, nil, seekErr
+		}
+		source, linkType, decompressor, streamErr := openStream(counter.wrapReader(file))
+		if streamErr != nil {
+			file.Close()
+			return nil, 0, nil, streamErr
+		}
+		return source, linkType, closers{decompressor, file}, nil
+	}
+	file.Close()
+
+	handle, openErr := pcap.OpenOffline(filename)
+	if openErr != nil {
+		return nil, 0, nil, openErr
+	}
+
+	// libpcap reads the file on its own, count the packets instead
+	return counter.wrapSource(handle), handle.LinkType(), closerFunc(func() error {
+		handle.Close()
+		return nil
+	}), nil
+}
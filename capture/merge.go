@@ -0,0 +1,213 @@
+package capture
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Name of the file a packet was read from, attached to the ancillary data of the packet if several files are merged
+type origin string
+
+// Expands the given file names, directories and glob patterns to the list of capture files to read.
+// Directories are expanded to the files inside them (not recursively), sorted by name.
+func Expand(patterns []string) ([]string, error) {
+	var filenames []string
+
+	for _, pattern := range patterns {
+		// Check if this is a glob pattern
+		if pattern != "-" && strings.ContainsAny(pattern, "*?[") {
+			matches, globErr := filepath.Glob(pattern)
+			if globErr != nil {
+				return nil, globErr
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files matching %s", pattern)
+			}
+			filenames = append(filenames, matches...)
+			continue
+		}
+
+		// Check if this is a directory
+		info, statErr := os.Stat(pattern)
+		if pattern != "-" && statErr == nil && info.IsDir() {
+			entries, readErr := readDir(pattern)
+			if readErr != nil {
+				return nil, readErr
+			}
+			if len(entries) == 0 {
+				return nil, fmt.Errorf("no files in directory %s", pattern)
+			}
+			filenames = append(filenames, entries...)
+			continue
+		}
+
+		// Plain file (or stdin), errors are reported when opening it
+		filenames = append(filenames, pattern)
+	}
+
+	return filenames, nil
+}
+
+// Returns the regular files inside the given directory, sorted by name
+func readDir(directory string) ([]string, error) {
+	dir, openErr := os.Open(directory)
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer dir.Close()
+
+	infos, readErr := dir.Readdir(-1)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	var filenames []string
+	for _, i := range infos {
+		if i.Mode().IsRegular() {
+			filenames = append(filenames, filepath.Join(directory, i.Name()))
+		}
+	}
+	sort.Strings(filenames)
+
+	return filenames, nil
+}
+
+// Opens all given capture files and merges their packets by timestamp into a single packet source.
+// All files need to share the same link type. The name of the file each packet came from is available via Origin.
+// If counter is not nil, it counts the bytes read from the files.
+// The returned closer closes all files, and should be called after the packets were read.
+func OpenAll(filenames []string, counter *ReadCounter) (*gopacket.PacketSource, layers.LinkType, io.Closer, error) {
+	if len(filenames) == 1 {
+		dataSource, linkType, closer, openErr := open(filenames[0], counter)
+		if openErr != nil {
+			return nil, 0, nil, openErr
+		}
+		return gopacket.NewPacketSource(dataSource, decoder(linkType)), linkType, closer, nil
+	}
+
+	merged := &mergeSource{}
+	var linkType layers.LinkType
+	var files closers
+	for i, f := range filenames {
+		if f == "-" {
+			files.Close()
+			return nil, 0, nil, fmt.Errorf("stdin can't be merged with other files")
+		}
+
+		source, thisLinkType, closer, openErr := openFile(f, counter)
+		if openErr != nil {
+			files.Close()
+			return nil, 0, nil, fmt.Errorf("%s: %s", f, openErr.Error())
+		}
+		files = append(files, closer)
+
+		// Check if the link types match, we can only decode packets of a single link type
+		if i == 0 {
+			linkType = thisLinkType
+		} else if thisLinkType != linkType {
+			files.Close()
+			return nil, 0, nil, fmt.Errorf("%s has link type %s, but %s has link type %s", f, thisLinkType, filenames[0], linkType)
+		}
+
+		// Read the first packet of the file, empty files are simply skipped
+		input := &mergeInput{name: f, source: source, index: i}
+		if input.next() {
+			merged.inputs = append(merged.inputs, input)
+		}
+	}
+	heap.Init(&merged.inputs)
+
+	return gopacket.NewPacketSource(merged, decoder(linkType)), linkType, files, nil
+}
+
+// Origin returns the name of the file the given packet was read from, if several files were merged by OpenAll.
+// Otherwise, it returns an empty string.
+//
+// The flow table notes the origin of the first packet of each flow, which is how TCP streams and the files
+// carved from them are traced back. Summaries aggregating many packets, like the DNS domains, don't name files.
+func Origin(packet gopacket.Packet) string {
+	for _, a := range packet.Metadata().AncillaryData {
+		if o, ok := a.(origin); ok {
+			return string(o)
+		}
+	}
+	return ""
+}
+
+// A single file of a merged capture, along with the next packet to be read from it
+type mergeInput struct {
+	name   string
+	source gopacket.PacketDataSource
+	index  int
+	data   []byte
+	ci     gopacket.CaptureInfo
+}
+
+// Reads the next packet of the file. Returns false if there are no more packets.
+// Truncated files, e.g. the last file of a ring buffer, are read up to the broken packet.
+func (i *mergeInput) next() bool {
+	data, ci, readErr := i.source.ReadPacketData()
+	if readErr != nil {
+		if readErr != io.EOF {
+			log.Printf("Stopped reading %s: %s", i.name, readErr.Error())
+		}
+		return false
+	}
+
+	i.data = data
+	i.ci = ci
+	i.ci.AncillaryData = append(i.ci.AncillaryData, origin(i.name))
+	return true
+}
+
+// A heap of files, ordered by the timestamp of their next packet
+type mergeHeap []*mergeInput
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(a, b int) bool {
+	// Keep packets with the same timestamp in the order the files were given
+	if h[a].ci.Timestamp.Equal(h[b].ci.Timestamp) {
+		return h[a].index < h[b].index
+	}
+	return h[a].ci.Timestamp.Before(h[b].ci.Timestamp)
+}
+func (h mergeHeap) Swap(a, b int)       { h[a], h[b] = h[b], h[a] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeInput)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// A packet data source returning the packets of several files in timestamp order
+type mergeSource struct {
+	inputs mergeHeap
+}
+
+// Returns the earliest packet of all files
+func (m *mergeSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if len(m.inputs) == 0 {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+
+	// Take the packet of the file next in line, and read the next one from that file
+	input := m.inputs[0]
+	data, ci := input.data, input.ci
+	if input.next() {
+		heap.Fix(&m.inputs, 0)
+	} else {
+		heap.Pop(&m.inputs)
+	}
+
+	return data, ci, nil
+}
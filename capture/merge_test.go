@@ -0,0 +1,124 @@
+package capture
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// Writes a pcap file with a single byte packet for each of the given timestamps, in seconds after start
+func writeCapture(t *testing.T, filename string, compress bool, start time.Time, packets ...int) {
+	file, createErr := os.Create(filename)
+	if createErr != nil {
+		t.Fatal(createErr)
+	}
+	defer file.Close()
+
+	var w io.Writer = file
+	if compress {
+		gzipWriter := gzip.NewWriter(file)
+		defer gzipWriter.Close()
+		w = gzipWriter
+	}
+
+	writer := pcapgo.NewWriter(w)
+	if headerErr := writer.WriteFileHeader(65535, layers.LinkTypeEthernet); headerErr != nil {
+		t.Fatal(headerErr)
+	}
+	for _, p := range packets {
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(p) * time.Second), CaptureLength: 1, Length: 1}
+		if writeErr := writer.WritePacket(ci, []byte{byte(p)}); writeErr != nil {
+			t.Fatal(writeErr)
+		}
+	}
+}
+
+func TestOpenAllMerge(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "pancap-merge")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	first := filepath.Join(dir, "a.pcap")
+	second := filepath.Join(dir, "b.pcap.gz")
+	empty := filepath.Join(dir, "c.pcap")
+	writeCapture(t, first, false, start, 1, 3, 5, 5)
+	writeCapture(t, second, true, start, 2, 3, 4, 6)
+	writeCapture(t, empty, false, start)
+
+	filenames, expandErr := Expand([]string{dir})
+	if expandErr != nil {
+		t.Fatal(expandErr)
+	}
+	if len(filenames) != 3 || filenames[0] != first || filenames[1] != second || filenames[2] != empty {
+		t.Fatalf("got files %v, expected %s, %s and %s", filenames, first, second, empty)
+	}
+
+	counter := &ReadCounter{}
+	source, linkType, closer, openErr := OpenAll(filenames, counter)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	defer closer.Close()
+	if linkType != layers.LinkTypeEthernet {
+		t.Errorf("got link type %s, expected %s", linkType, layers.LinkTypeEthernet)
+	}
+
+	// Packets are ordered by timestamp, and by the order of the files if their timestamps are equal
+	expected := []struct {
+		second int
+		origin string
+	}{
+		{1, first}, {2, second}, {3, first}, {3, second}, {4, second}, {5, first}, {5, first}, {6, second},
+	}
+	for i, e := range expected {
+		packet, packetErr := source.NextPacket()
+		if packetErr != nil {
+			t.Fatalf("packet %d: %s", i, packetErr)
+		}
+		if got := int(packet.Data()[0]); got != e.second {
+			t.Errorf("packet %d: got packet at second %d, expected %d", i, got, e.second)
+		}
+		if origin := Origin(packet); origin != e.origin {
+			t.Errorf("packet %d: got origin %s, expected %s", i, origin, e.origin)
+		}
+	}
+	if _, packetErr := source.NextPacket(); packetErr != io.EOF {
+		t.Errorf("got %v after the last packet, expected EOF", packetErr)
+	}
+	if counter.BytesRead() == 0 || counter.Size() == 0 {
+		t.Errorf("got %d of %d bytes read, expected both to be counted", counter.BytesRead(), counter.Size())
+	}
+}
+
+func TestOpenAllLinkTypeMismatch(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "pancap-merge")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	ethernet := filepath.Join(dir, "ethernet.pcap")
+	writeCapture(t, ethernet, false, time.Now(), 1)
+	raw := filepath.Join(dir, "raw.pcap")
+	file, createErr := os.Create(raw)
+	if createErr != nil {
+		t.Fatal(createErr)
+	}
+	pcapgo.NewWriter(file).WriteFileHeader(65535, layers.LinkTypeRaw)
+	file.Close()
+
+	if _, _, _, openErr := OpenAll([]string{ethernet, raw}, nil); openErr == nil {
+		t.Errorf("merged files of different link types without error")
+	}
+}
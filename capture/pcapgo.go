@@ -0,0 +1,29 @@
+//go:build !libpcap
+// +build !libpcap
+
+package capture
+
+import (
+	"io"
+	"os"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Opens the given file with the pure-Go readers, counting the bytes read with counter (if not nil).
+// The returned closer closes the file.
+func openFile(filename string, counter *ReadCounter) (gopacket.PacketDataSource, layers.LinkType, io.Closer, error) {
+	file, openErr := os.Open(filename)
+	if openErr != nil {
+		return nil, 0, nil, openErr
+	}
+	counter.addFile(file)
+
+	source, linkType, decompressor, streamErr := openStream(counter.wrapReader(file))
+	if streamErr != nil {
+		file.Close()
+		return nil, 0, nil, streamErr
+	}
+	return source, linkType, closers{decompressor, file}, nil
+}
@@ -0,0 +1,57 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+var (
+	// Magic bytes at the beginning of a pcapng file (Section Header Block)
+	pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+	// Magic bytes at the beginning of a pcap file, in both byte orders, with microsecond and nanosecond resolution
+	pcapMagics = [][]byte{
+		{0xa1, 0xb2, 0xc3, 0xd4},
+		{0xd4, 0xc3, 0xb2, 0xa1},
+		{0xa1, 0xb2, 0x3c, 0x4d},
+		{0x4d, 0x3c, 0xb2, 0xa1},
+	}
+)
+
+// Reads packets from the given pcap or pcapng stream with the pure-Go readers of gopacket
+func newReader(r io.Reader) (gopacket.PacketDataSource, layers.LinkType, error) {
+	buffered := bufio.NewReader(r)
+
+	// Check which format we got by the magic bytes
+	magic, peekErr := buffered.Peek(4)
+	if peekErr != nil {
+		return nil, 0, fmt.Errorf("unable to read capture header: %s", peekErr.Error())
+	}
+
+	if bytes.Equal(magic, pcapngMagic) {
+		// pcapng file
+		ngReader, ngErr := pcapgo.NewNgReader(buffered, pcapgo.DefaultNgReaderOptions)
+		if ngErr != nil {
+			return nil, 0, ngErr
+		}
+		return ngReader, ngReader.LinkType(), nil
+	}
+
+	for _, m := range pcapMagics {
+		if bytes.Equal(magic, m) {
+			// Plain old pcap file
+			reader, readerErr := pcapgo.NewReader(buffered)
+			if readerErr != nil {
+				return nil, 0, readerErr
+			}
+			return reader, reader.LinkType(), nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("unknown capture format (magic bytes %x)", magic)
+}
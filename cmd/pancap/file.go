@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/capture"
+	"github.com/maride/pancap/filter"
+	"github.com/maride/pancap/output"
+)
+
+var (
+	filenamesFlag fileList
+	filterFlag    string
+	fromFlag      string
+	toFlag        string
+)
+
+// A flag which may be given multiple times, collecting all values
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Registers the flag --file
+func registerFileFlags() {
+	flag.Var(&filenamesFlag, "file", "PCAP file to base analysis on, possibly compressed. Use - to read from stdin. May be given multiple times, also accepts directories and glob patterns; packets of all files are merged by timestamp")
+	flag.StringVar(&filterFlag, "filter", "", "Only analyze packets matching this filter, in tcpdump syntax, e.g. \"tcp port 80 and host 10.0.0.5\"")
+	flag.StringVar(&fromFlag, "from", "", "Only analyze packets captured at or after this time, either as RFC3339 timestamp or as offset from the start of the capture, e.g. 1h30m")
+	flag.StringVar(&toFlag, "to", "", "Only analyze packets captured at or before this time, either as RFC3339 timestamp or as offset from the start of the capture, e.g. 1h35m")
+}
+
+// Opens the PCAP files, returns their packets, the link type, the names of the opened files and a closer for them or an error.
+// The bytes read from the files are counted with counter.
+func openPCAP(counter *capture.ReadCounter) (*gopacket.PacketSource, layers.LinkType, []string, io.Closer, error) {
+	// Check if we even got a file.
+	if len(filenamesFlag) == 0 {
+		return nil, 0, nil, nil, fmt.Errorf("missing file to analyze. Please specifiy it with --file")
+	}
+
+	// Expand directories and glob patterns
+	filenames, expandErr := capture.Expand(filenamesFlag)
+	if expandErr != nil {
+		return nil, 0, nil, nil, expandErr
+	}
+
+	// Open specified files
+	packetSource, linkType, closer, openErr := capture.OpenAll(filenames, counter)
+	if openErr != nil {
+		// There were some problems opening the file
+		return nil, 0, nil, nil, openErr
+	}
+
+	// Output basic information about this PCAP
+	if output.TextMode() {
+		if len(filenames) > 1 {
+			fmt.Printf("Merging %d files by timestamp\n", len(filenames))
+		}
+		fmt.Printf("PCAP capture link type is %s (ID %d)\n", linkType.String(), linkType)
+	}
+
+	return packetSource, linkType, filenames, closer, nil
+}
+
+// Compiles the filter given by the user for the given link type, returns nil if no filter was given
+func compileFilter(linkType layers.LinkType) (*filter.Filter, error) {
+	if filterFlag == "" {
+		return nil, nil
+	}
+
+	return filter.New(filterFlag, linkType)
+}
+
+// Returns the time window given by the user, or nil if no window was given
+func parseWindow() (*filter.Window, error) {
+	if fromFlag == "" && toFlag == "" {
+		return nil, nil
+	}
+
+	return filter.NewWindow(fromFlag, toFlag)
+}
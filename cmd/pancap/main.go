@@ -7,47 +7,82 @@ import (
 	"math/rand"
 	"time"
 
-	"github.com/maride/pancap/analyze"
+	"github.com/maride/pancap"
+	"github.com/maride/pancap/capture"
 	"github.com/maride/pancap/output"
 )
 
 func main() {
-	// important things first
-	printMOTD()
-
 	// register flags
 	registerFileFlags()
+	registerAnalyzerFlags()
 	output.RegisterFlags()
 	flag.Parse()
 
+	// Check if the user only wants to know about the modules
+	if listModulesFlag {
+		printModules()
+		return
+	}
+
+	// Check flags before doing anything
+	if flagErr := output.CheckFlags(); flagErr != nil {
+		log.Fatalf("Invalid flags: %s", flagErr.Error())
+	}
+
+	// important things first - at least if we are talking to a human
+	if output.TextMode() {
+		printMOTD()
+	}
+
+	// Check how to report progress
+	counter := &capture.ReadCounter{}
+	reporter, progressErr := progressReporter(counter)
+	if progressErr != nil {
+		log.Fatalf("Invalid flags: %s", progressErr.Error())
+	}
+
 	// Open the given PCAP
-	packetSource, _, fileErr := openPCAP()
+	packetSource, linkType, filenames, files, fileErr := openPCAP(counter)
 	if fileErr != nil {
 		// Encountered problems with the PCAP - permission and/or existance error
 		log.Fatalf("Error occured while opeining specified file: %s", fileErr.Error())
 	}
 
+	// Compile the filter for the link type of the PCAP
+	options := analyzerOptions()
+	packetFilter, filterErr := compileFilter(linkType)
+	if filterErr != nil {
+		log.Fatalf("Invalid filter: %s", filterErr.Error())
+	}
+	options.Filter = packetFilter
+
+	// Parse the time window
+	window, windowErr := parseWindow()
+	if windowErr != nil {
+		log.Fatalf("Invalid time window: %s", windowErr.Error())
+	}
+	options.Window = window
+	options.Progress = reporter
+
 	// Start analyzing
-	analyzeErr := analyze.Analyze(packetSource)
+	report, analyzeErr := pancap.NewAnalyzer(options).Run(packetSource)
+	files.Close()
 	if analyzeErr != nil {
 		// Mh, encountered some problems while analyzing file
 		log.Fatalf("Error occurred while analyzing: %s", analyzeErr.Error())
 	}
+	report.Capture = output.Capture{
+		Files:      filenames,
+		LinkType:   linkType.String(),
+		LinkTypeID: int(linkType),
+	}
 
-	// Extract found and requested files
-	output.StoreFiles()
-
-	// Create communication graph
-	output.CreateGraph()
-
-	// Show user analysis
-	analyze.PrintSummary()
-
-	// Print filemanager summary
-	output.PrintSummary()
+	// Show user analysis, along with the filemanager summary, graph and so on
+	output.PrintReport(*report)
 
 	// Finalize output
-	output.Finalize()
+	output.Finalize(*report)
 }
 
 // Prints a simple figlet-style ASCII art and a random quote
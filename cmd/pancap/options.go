@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/maride/pancap"
+	"github.com/maride/pancap/capture"
+	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/progress"
+)
+
+var (
+	targetFiles     string
+	targetAllFiles  bool
+	targetOutput    string
+	modulesFlag     string
+	skipModulesFlag string
+	listModulesFlag bool
+	progressFlag    string
+	verboseErrors   bool
+	topFlag         int
+	dumpStreams     string
+
+	// Names of the flags setting module options, like "usbkeyboard.layout"
+	moduleOptionFlags = make(map[string]bool)
+)
+
+// Registers the flags configuring the analysis itself
+func registerAnalyzerFlags() {
+	flag.StringVar(&targetFiles, "extract-these", "", "Comma-separated list of files to extract.")
+	flag.BoolVar(&targetAllFiles, "extract-all", false, "Extract all files found.")
+	flag.StringVar(&targetOutput, "extract-to", "./extracted", "Directory to store extracted files in.")
+	flag.StringVar(&dumpStreams, "dump-streams", "", "Directory to write every TCP stream and UDP pseudo-stream to, as client, server and combined files.")
+	flag.StringVar(&modulesFlag, "modules", "", "Comma-separated list of modules to run, instead of all modules enabled by default.")
+	flag.StringVar(&skipModulesFlag, "skip-modules", "", "Comma-separated list of modules not to run.")
+	flag.BoolVar(&listModulesFlag, "list-modules", false, "List all available modules and exit.")
+	flag.IntVar(&topFlag, "top", 10, "Amount of entries shown in top lists, e.g. of conversations and hosts.")
+	flag.BoolVar(&verboseErrors, "verbose-errors", false, "Log every error encountered by a module, instead of only counting them.")
+	flag.StringVar(&progressFlag, "progress", "auto", "How to report progress on stderr: text, json (one object per line, for wrappers), off, or auto (text if stderr is a terminal).")
+
+	// Each module option gets its own flag, named after the module and the option
+	for _, m := range pancap.Modules() {
+		for _, o := range m.Options {
+			name := m.Name + "." + o.Name
+			flag.String(name, o.Default, fmt.Sprintf("%s (module %s).", o.Description, m.Name))
+			moduleOptionFlags[name] = true
+		}
+	}
+}
+
+// Returns the analyzer options as specified by the flags
+func analyzerOptions() pancap.Options {
+	options := pancap.Options{
+		ExtractAll:    targetAllFiles,
+		ExtractTo:     targetOutput,
+		DumpStreams:   dumpStreams,
+		ModuleOptions: make(map[string]string),
+		Top:           topFlag,
+		VerboseErrors: verboseErrors,
+		ErrorExamples: output.FullOutput(),
+	}
+	if targetFiles != "" {
+		options.ExtractFiles = strings.Split(targetFiles, ",")
+	}
+	if modulesFlag != "" {
+		options.Modules = strings.Split(modulesFlag, ",")
+	}
+	if skipModulesFlag != "" {
+		options.SkipModules = strings.Split(skipModulesFlag, ",")
+	}
+
+	// Only hand over the module options given by the user, all others keep their default
+	flag.Visit(func(f *flag.Flag) {
+		if moduleOptionFlags[f.Name] {
+			options.ModuleOptions[f.Name] = f.Value.String()
+		}
+	})
+	return options
+}
+
+// Returns the progress reporter as specified by the flags, reporting the bytes read as counted by counter
+func progressReporter(counter *capture.ReadCounter) (*progress.Reporter, error) {
+	mode, modeErr := progress.ParseMode(progressFlag)
+	if modeErr != nil {
+		return nil, modeErr
+	}
+	return progress.New(mode, os.Stderr, counter), nil
+}
+
+// Prints all available modules along with their description
+func printModules() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, m := range pancap.Modules() {
+		state := "disabled"
+		if m.Enabled {
+			state = "enabled"
+		}
+		fmt.Fprintf(w, "%s\t(%s by default)\t%s\n", m.Name, state, m.Description)
+		for _, o := range m.Options {
+			fmt.Fprintf(w, "\t-%s.%s\t%s (default %s)\n", m.Name, o.Name, o.Description, o.Default)
+		}
+	}
+	w.Flush()
+}
@@ -16,6 +16,16 @@ func AppendIfUnique(appendee string, array []string) []string {
 	return append(array, appendee)
 }
 
+// Contains checks if the array contains the given element
+func Contains(array []string, elem string) bool {
+	for _, e := range array {
+		if e == elem {
+			return true
+		}
+	}
+	return false
+}
+
 // Generates a small ASCII tree for the given string array
 func GenerateTree(strarr []string) string {
 	tmpstr := ""
@@ -33,3 +43,40 @@ func GenerateTree(strarr []string) string {
 	// Return constructed (grown?) tree
 	return tmpstr
 }
+
+// TreeNode is a single entry of a nested tree, along with its children.
+// Values optionally hold further columns of the entry, e.g. counts.
+type TreeNode struct {
+	Label    string        `json:"label"`
+	Values   []interface{} `json:"values,omitempty"`
+	Children []TreeNode    `json:"children,omitempty"`
+}
+
+// Generates an ASCII tree like GenerateTree, but for nested nodes
+func GenerateNestedTree(nodes []TreeNode) string {
+	tmpstr := ""
+	WalkNestedTree(nodes, func(line string, node TreeNode) {
+		tmpstr += line + "\n"
+	})
+	return tmpstr
+}
+
+// Calls visit for each of the given nodes and their children, in the order they appear in the ASCII tree,
+// with line being the label of the node prefixed with the tree characters
+func WalkNestedTree(nodes []TreeNode, visit func(line string, node TreeNode)) {
+	walkNestedTree(nodes, "", visit)
+}
+
+// Walks the tree for the given nodes, prefixing each line with indent
+func walkNestedTree(nodes []TreeNode, indent string, visit func(line string, node TreeNode)) {
+	for iter, node := range nodes {
+		// check if we got the last element, and continue the line to the next sibling otherwise
+		if iter < len(nodes)-1 {
+			visit(fmt.Sprintf("%s├ %s", indent, node.Label), node)
+			walkNestedTree(node.Children, indent+"│ ", visit)
+		} else {
+			visit(fmt.Sprintf("%s╰ %s", indent, node.Label), node)
+			walkNestedTree(node.Children, indent+"  ", visit)
+		}
+	}
+}
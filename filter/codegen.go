@@ -0,0 +1,509 @@
+//go:build !libpcap
+// +build !libpcap
+
+package filter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+// Layout of the link layer header
+type link struct {
+	// Offset of the EtherType, or -1 if the link type carries IP only
+	typeOffset int
+	// Offset of the network layer header
+	network uint32
+	// Whether the header carries ethernet addresses at offset 0 (destination) and 6 (source)
+	ethernet bool
+}
+
+// Link types supported by the pure-Go compiler
+var links = map[layers.LinkType]link{
+	layers.LinkTypeEthernet: {typeOffset: 12, network: 14, ethernet: true},
+	layers.LinkTypeLinuxSLL: {typeOffset: 14, network: 16},
+	layers.LinkTypeRaw:      {typeOffset: -1, network: 0},
+	layers.LinkTypeIPv4:     {typeOffset: -1, network: 0},
+	layers.LinkTypeIPv6:     {typeOffset: -1, network: 0},
+}
+
+// IP protocol numbers of the protocols usable as qualifier
+var ipProtocols = map[string]uint32{
+	"icmp":  1,
+	"igmp":  2,
+	"tcp":   6,
+	"udp":   17,
+	"icmp6": 58,
+	"sctp":  132,
+}
+
+// A check of a single value of the packet, the building block of all primitives
+type test struct {
+	// Size of the value in bytes (1, 2 or 4), or 0 for the length of the packet
+	size int
+	// Offset of the value, relative to the end of the IPv4 header if indirect is set
+	offset   uint32
+	indirect bool
+	// Mask applied to the value before comparing it, if not zero
+	mask  uint32
+	cond  bpf.JumpTest
+	value uint32
+}
+
+// A primitive which is always (or never) true, e.g. "arp" on a link type carrying IP only
+type constant bool
+
+// Holds the state while generating the program
+type generator struct {
+	link         link
+	instructions []instruction
+	labels       []int
+}
+
+// A single instruction, with jumps pointing to labels until the program is complete
+type instruction struct {
+	ins bpf.Instruction
+	// Conditional jump, if ins is nil
+	cond  bpf.JumpTest
+	value uint32
+	// Labels to jump to
+	jumpTrue  int
+	jumpFalse int
+	// Unconditional jump to jumpTrue, if ins is nil
+	always bool
+}
+
+// Generates the BPF program for the given expression and link type
+func generate(tree expr, linkType layers.LinkType) ([]bpf.Instruction, error) {
+	l, ok := links[linkType]
+	if !ok {
+		return nil, fmt.Errorf("link type %s is not supported, filters work on ethernet, linux cooked and raw IP captures", linkType)
+	}
+	g := &generator{link: l}
+
+	// Break the primitives down into tests
+	tests, expandErr := g.expand(tree)
+	if expandErr != nil {
+		return nil, expandErr
+	}
+
+	// Generate the instructions, returning the snap length for matching packets and 0 for all others
+	accept := g.newLabel()
+	reject := g.newLabel()
+	g.emit(tests, accept, reject)
+	g.place(accept)
+	g.add(bpf.RetConstant{Val: snapLength})
+	g.place(reject)
+	g.add(bpf.RetConstant{Val: 0})
+
+	return g.resolve()
+}
+
+// Replaces all primitives of the given expression by tests
+func (g *generator) expand(e expr) (expr, error) {
+	switch v := e.(type) {
+	case andExpr:
+		left, leftErr := g.expand(v.left)
+		if leftErr != nil {
+			return nil, leftErr
+		}
+		right, rightErr := g.expand(v.right)
+		return andExpr{left, right}, rightErr
+	case orExpr:
+		left, leftErr := g.expand(v.left)
+		if leftErr != nil {
+			return nil, leftErr
+		}
+		right, rightErr := g.expand(v.right)
+		return orExpr{left, right}, rightErr
+	case notExpr:
+		operand, operandErr := g.expand(v.operand)
+		return notExpr{operand}, operandErr
+	case primitive:
+		return g.expandPrimitive(v)
+	}
+	return e, nil
+}
+
+// Breaks the given primitive down into tests
+func (g *generator) expandPrimitive(p primitive) (expr, error) {
+	switch p.kind {
+	case "":
+		return g.protocol(p.proto)
+	case "host", "net":
+		return g.host(p)
+	case "port", "portrange":
+		return g.port(p)
+	case "proto":
+		return g.ipProtocol(p)
+	case "less", "greater":
+		length, parseErr := strconv.ParseUint(p.id, 10, 32)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid length '%s'", p.id)
+		}
+		if p.kind == "less" {
+			return notExpr{test{size: 0, cond: bpf.JumpGreaterThan, value: uint32(length)}}, nil
+		}
+		return test{size: 0, cond: bpf.JumpGreaterOrEqual, value: uint32(length)}, nil
+	}
+	return nil, fmt.Errorf("unknown primitive '%s'", p.kind)
+}
+
+// Returns the tests for a bare protocol like "tcp"
+func (g *generator) protocol(proto string) (expr, error) {
+	switch proto {
+	case "ip":
+		return g.etherType(layers.EthernetTypeIPv4), nil
+	case "ip6":
+		return g.etherType(layers.EthernetTypeIPv6), nil
+	case "arp":
+		return g.etherType(layers.EthernetTypeARP), nil
+	case "rarp":
+		return g.etherType(0x8035), nil
+	case "icmp", "igmp":
+		return g.ipv4Protocol(ipProtocols[proto]), nil
+	case "icmp6":
+		return g.ipv6Protocol(ipProtocols[proto]), nil
+	case "tcp", "udp", "sctp":
+		return orExpr{g.ipv4Protocol(ipProtocols[proto]), g.ipv6Protocol(ipProtocols[proto])}, nil
+	}
+	return nil, fmt.Errorf("'%s' needs to be followed by a host, port or proto", proto)
+}
+
+// Returns the test for the given EtherType
+func (g *generator) etherType(etherType layers.EthernetType) expr {
+	if g.link.typeOffset >= 0 {
+		return test{size: 2, offset: uint32(g.link.typeOffset), cond: bpf.JumpEqual, value: uint32(etherType)}
+	}
+
+	// No EtherType available, check the IP version instead
+	switch etherType {
+	case layers.EthernetTypeIPv4:
+		return test{size: 1, offset: g.link.network, mask: 0xf0, cond: bpf.JumpEqual, value: 0x40}
+	case layers.EthernetTypeIPv6:
+		return test{size: 1, offset: g.link.network, mask: 0xf0, cond: bpf.JumpEqual, value: 0x60}
+	}
+	return constant(false)
+}
+
+// Returns the tests for IPv4 packets carrying the given protocol
+func (g *generator) ipv4Protocol(number uint32) expr {
+	return andExpr{g.etherType(layers.EthernetTypeIPv4), test{size: 1, offset: g.link.network + 9, cond: bpf.JumpEqual, value: number}}
+}
+
+// Returns the tests for IPv6 packets carrying the given protocol, not following any extension headers
+func (g *generator) ipv6Protocol(number uint32) expr {
+	return andExpr{g.etherType(layers.EthernetTypeIPv6), test{size: 1, offset: g.link.network + 6, cond: bpf.JumpEqual, value: number}}
+}
+
+// Returns the tests for "ip proto", "ip6 proto" and "proto"
+func (g *generator) ipProtocol(p primitive) (expr, error) {
+	// Protocols may be given by name, escaped by a backslash like "\tcp" in tcpdump
+	name := strings.TrimPrefix(p.id, "\\")
+	number, known := ipProtocols[name]
+	if !known {
+		parsed, parseErr := strconv.ParseUint(name, 10, 8)
+		if parseErr != nil {
+			return nil, fmt.Errorf("unknown protocol '%s'", p.id)
+		}
+		number = uint32(parsed)
+	}
+
+	switch p.proto {
+	case "ip":
+		return g.ipv4Protocol(number), nil
+	case "ip6":
+		return g.ipv6Protocol(number), nil
+	case "":
+		return orExpr{g.ipv4Protocol(number), g.ipv6Protocol(number)}, nil
+	}
+	return nil, fmt.Errorf("unsupported primitive '%s proto'", p.proto)
+}
+
+// Returns the tests for "host" and "net" primitives
+func (g *generator) host(p primitive) (expr, error) {
+	if p.proto == "ether" {
+		return g.etherHost(p)
+	}
+
+	// Parse the address or network
+	var network *net.IPNet
+	if p.kind == "net" && strings.Contains(p.id, "/") {
+		_, parsed, parseErr := net.ParseCIDR(p.id)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid network '%s'", p.id)
+		}
+		network = parsed
+	} else {
+		ip := net.ParseIP(p.id)
+		if ip == nil {
+			return nil, fmt.Errorf("'%s' is not an IP address (host names are not supported)", p.id)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			network = &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+		} else {
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+		}
+	}
+
+	if network.IP.To4() != nil {
+		nh := g.link.network
+		ipTests := andExpr{g.etherType(layers.EthernetTypeIPv4), direction(p.dir, address(nh+12, network), address(nh+16, network))}
+		arpTests := andExpr{g.etherType(layers.EthernetTypeARP), direction(p.dir, address(nh+14, network), address(nh+24, network))}
+		rarpTests := andExpr{g.etherType(0x8035), direction(p.dir, address(nh+14, network), address(nh+24, network))}
+
+		switch p.proto {
+		case "":
+			return orExpr{ipTests, orExpr{arpTests, rarpTests}}, nil
+		case "ip":
+			return ipTests, nil
+		case "arp":
+			return arpTests, nil
+		case "rarp":
+			return rarpTests, nil
+		}
+	} else if p.proto == "" || p.proto == "ip6" {
+		nh := g.link.network
+		return andExpr{g.etherType(layers.EthernetTypeIPv6), direction(p.dir, address(nh+8, network), address(nh+24, network))}, nil
+	}
+
+	return nil, fmt.Errorf("'%s %s' can't be used with %s", p.proto, p.kind, p.id)
+}
+
+// Returns the tests for "ether host" primitives
+func (g *generator) etherHost(p primitive) (expr, error) {
+	if !g.link.ethernet {
+		return nil, fmt.Errorf("'ether host' is only supported on ethernet captures")
+	}
+	if p.kind != "host" {
+		return nil, fmt.Errorf("'ether %s' is not supported", p.kind)
+	}
+
+	mac, parseErr := net.ParseMAC(p.id)
+	if parseErr != nil || len(mac) != 6 {
+		return nil, fmt.Errorf("'%s' is not a MAC address", p.id)
+	}
+
+	macTests := func(offset uint32) expr {
+		return andExpr{
+			test{size: 4, offset: offset + 2, cond: bpf.JumpEqual, value: binary.BigEndian.Uint32(mac[2:])},
+			test{size: 2, offset: offset, cond: bpf.JumpEqual, value: uint32(binary.BigEndian.Uint16(mac[:2]))},
+		}
+	}
+	return direction(p.dir, macTests(6), macTests(0)), nil
+}
+
+// Returns the tests for "port" and "portrange" primitives
+func (g *generator) port(p primitive) (expr, error) {
+	// Check which transport protocols we should look at
+	var protocols []string
+	switch p.proto {
+	case "":
+		protocols = []string{"tcp", "udp", "sctp"}
+	case "tcp", "udp", "sctp":
+		protocols = []string{p.proto}
+	default:
+		return nil, fmt.Errorf("'%s %s' is not supported", p.proto, p.kind)
+	}
+
+	// Parse the port or the range of ports
+	low, high, parseErr := parsePorts(p)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	portTests := func(offset uint32, indirect bool) expr {
+		if low == high {
+			return test{size: 2, offset: offset, indirect: indirect, cond: bpf.JumpEqual, value: low}
+		}
+		return andExpr{
+			test{size: 2, offset: offset, indirect: indirect, cond: bpf.JumpGreaterOrEqual, value: low},
+			notExpr{test{size: 2, offset: offset, indirect: indirect, cond: bpf.JumpGreaterThan, value: high}},
+		}
+	}
+
+	nh := g.link.network
+	var result expr
+	for _, proto := range protocols {
+		// On IPv4, skip fragments other than the first one, they don't carry ports
+		ipv4 := andExpr{
+			andExpr{g.ipv4Protocol(ipProtocols[proto]), notExpr{test{size: 2, offset: nh + 6, mask: 0x1fff, cond: bpf.JumpNotEqual, value: 0}}},
+			direction(p.dir, portTests(nh, true), portTests(nh+2, true)),
+		}
+		ipv6 := andExpr{g.ipv6Protocol(ipProtocols[proto]), direction(p.dir, portTests(nh+40, false), portTests(nh+42, false))}
+
+		if result == nil {
+			result = orExpr{ipv4, ipv6}
+		} else {
+			result = orExpr{result, orExpr{ipv4, ipv6}}
+		}
+	}
+	return result, nil
+}
+
+// Parses the port or port range of the given primitive, ports may also be given by name like "http"
+func parsePorts(p primitive) (uint32, uint32, error) {
+	parts := []string{p.id}
+	if p.kind == "portrange" {
+		parts = strings.SplitN(p.id, "-", 2)
+		if len(parts) != 2 {
+			return 0, 0, fmt.Errorf("invalid port range '%s'", p.id)
+		}
+	}
+
+	var ports []uint32
+	for _, part := range parts {
+		network := p.proto
+		if network != "tcp" && network != "udp" {
+			network = "tcp"
+		}
+		port, lookupErr := net.LookupPort(network, part)
+		if lookupErr != nil {
+			return 0, 0, fmt.Errorf("invalid port '%s'", part)
+		}
+		ports = append(ports, uint32(port))
+	}
+
+	if len(ports) == 1 {
+		return ports[0], ports[0], nil
+	}
+	if ports[0] > ports[1] {
+		return ports[1], ports[0], nil
+	}
+	return ports[0], ports[1], nil
+}
+
+// Returns the tests comparing the IPv4 or IPv6 address at the given offset with the given network
+func address(offset uint32, network *net.IPNet) expr {
+	ip := network.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	// Compare word by word, skipping words not covered by the mask
+	var result expr
+	for i := 0; i < len(ip); i += 4 {
+		mask := binary.BigEndian.Uint32(network.Mask[i : i+4])
+		if mask == 0 {
+			continue
+		}
+
+		t := test{size: 4, offset: offset + uint32(i), cond: bpf.JumpEqual, value: binary.BigEndian.Uint32(ip[i:i+4]) & mask}
+		if mask != 0xffffffff {
+			t.mask = mask
+		}
+
+		if result == nil {
+			result = t
+		} else {
+			result = andExpr{result, t}
+		}
+	}
+
+	if result == nil {
+		// Network covers all addresses, e.g. 0.0.0.0/0
+		return constant(true)
+	}
+	return result
+}
+
+// Combines the tests for source and destination according to the given direction
+func direction(dir string, src expr, dst expr) expr {
+	switch dir {
+	case "src":
+		return src
+	case "dst":
+		return dst
+	case "src and dst":
+		return andExpr{src, dst}
+	}
+	return orExpr{src, dst}
+}
+
+// Returns a new label, to be placed later on
+func (g *generator) newLabel() int {
+	g.labels = append(g.labels, -1)
+	return len(g.labels) - 1
+}
+
+// Places the given label at the next instruction
+func (g *generator) place(label int) {
+	g.labels[label] = len(g.instructions)
+}
+
+// Appends the given instruction
+func (g *generator) add(ins bpf.Instruction) {
+	g.instructions = append(g.instructions, instruction{ins: ins})
+}
+
+// Emits the instructions for the given expression, jumping to onTrue if it matches and to onFalse otherwise
+func (g *generator) emit(e expr, onTrue int, onFalse int) {
+	switch v := e.(type) {
+	case andExpr:
+		right := g.newLabel()
+		g.emit(v.left, right, onFalse)
+		g.place(right)
+		g.emit(v.right, onTrue, onFalse)
+	case orExpr:
+		right := g.newLabel()
+		g.emit(v.left, onTrue, right)
+		g.place(right)
+		g.emit(v.right, onTrue, onFalse)
+	case notExpr:
+		g.emit(v.operand, onFalse, onTrue)
+	case constant:
+		target := onFalse
+		if v {
+			target = onTrue
+		}
+		g.instructions = append(g.instructions, instruction{always: true, jumpTrue: target})
+	case test:
+		// Load the value...
+		switch {
+		case v.size == 0:
+			g.add(bpf.LoadExtension{Num: bpf.ExtLen})
+		case v.indirect:
+			g.add(bpf.LoadMemShift{Off: g.link.network})
+			g.add(bpf.LoadIndirect{Off: v.offset, Size: v.size})
+		default:
+			g.add(bpf.LoadAbsolute{Off: v.offset, Size: v.size})
+		}
+		if v.mask != 0 {
+			g.add(bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: v.mask})
+		}
+
+		// ... and compare it
+		g.instructions = append(g.instructions, instruction{cond: v.cond, value: v.value, jumpTrue: onTrue, jumpFalse: onFalse})
+	}
+}
+
+// Replaces the labels by relative jumps, returning the final program
+func (g *generator) resolve() ([]bpf.Instruction, error) {
+	program := make([]bpf.Instruction, len(g.instructions))
+
+	for i, ins := range g.instructions {
+		if ins.ins != nil {
+			program[i] = ins.ins
+			continue
+		}
+
+		skipTrue := g.labels[ins.jumpTrue] - (i + 1)
+		if ins.always {
+			program[i] = bpf.Jump{Skip: uint32(skipTrue)}
+			continue
+		}
+
+		skipFalse := g.labels[ins.jumpFalse] - (i + 1)
+		if skipTrue > 255 || skipFalse > 255 {
+			return nil, fmt.Errorf("filter is too complex")
+		}
+		program[i] = bpf.JumpIf{Cond: ins.cond, Val: ins.value, SkipTrue: uint8(skipTrue), SkipFalse: uint8(skipFalse)}
+	}
+
+	return program, nil
+}
@@ -0,0 +1,19 @@
+//go:build !libpcap
+// +build !libpcap
+
+package filter
+
+import (
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+// Compiles the given expression with the pure-Go compiler
+func compile(expression string, linkType layers.LinkType) ([]bpf.Instruction, error) {
+	tree, parseErr := parse(expression)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	return generate(tree, linkType)
+}
@@ -0,0 +1,79 @@
+//go:build !libpcap
+// +build !libpcap
+
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+func TestCompileRawIP(t *testing.T) {
+	// An IPv4 header without link layer, followed by a UDP header to port 53
+	packet := []byte{
+		0x45, 0, 0, 28, 0, 0, 0, 0, 64, 17, 0, 0, 10, 0, 0, 1, 8, 8, 8, 8,
+		0x14, 0xe9, 0x00, 0x35, 0, 8, 0, 0,
+	}
+
+	tests := []struct {
+		expression string
+		match      bool
+	}{
+		{"ip", true},
+		{"ip6", false},
+		{"arp", false},
+		{"udp port 53", true},
+		{"host 8.8.8.8", true},
+		{"tcp", false},
+	}
+
+	for _, test := range tests {
+		program, compileErr := compile(test.expression, layers.LinkTypeRaw)
+		if compileErr != nil {
+			t.Errorf("%s: %s", test.expression, compileErr)
+			continue
+		}
+		vm, vmErr := bpf.NewVM(program)
+		if vmErr != nil {
+			t.Errorf("%s: %s", test.expression, vmErr)
+			continue
+		}
+		verdict, runErr := vm.Run(packet)
+		if runErr != nil {
+			t.Errorf("%s: %s", test.expression, runErr)
+		} else if (verdict > 0) != test.match {
+			t.Errorf("%s: got verdict %d, expected match %t", test.expression, verdict, test.match)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        string
+	}{
+		{"tcp[13] & 2 != 0", "unsupported primitive 'tcp[13]'"},
+		{"vlan", "unsupported primitive 'vlan'"},
+		{"vlan 100 and tcp", "unsupported primitive 'vlan'"},
+		{"ether broadcast", "unsupported primitive 'broadcast'"},
+		{"tcp & 2", "unsupported primitive '&'"},
+		{"host example.com", "not an IP address"},
+		{"tcp port", "unexpected end of filter"},
+		{"tcp and", "unexpected end of filter"},
+		{"(tcp", "missing ')'"},
+		{"tcp)", "unexpected ')'"},
+		{"port 70000", "invalid port '70000'"},
+	}
+
+	for _, test := range tests {
+		_, compileErr := compile(test.expression, layers.LinkTypeEthernet)
+		if compileErr == nil {
+			t.Errorf("%s: compiled without error", test.expression)
+		} else if !strings.Contains(compileErr.Error(), test.err) {
+			t.Errorf("%s: got error \"%s\", expected \"%s\"", test.expression, compileErr, test.err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Package filter restricts an analysis to the packets matching a filter expression in tcpdump syntax,
+// e.g. "tcp port 80 and host 10.0.0.5", and to the packets captured in a time window.
+//
+// Filters are compiled to BPF and run by a BPF virtual machine on the raw packet data.
+// By default, filters are compiled by a pure-Go compiler supporting the most common primitives:
+// ip, ip6, arp, rarp, tcp, udp, sctp, icmp, icmp6, igmp, [src|dst] host, ether [src|dst] host, [src|dst] net,
+// [tcp|udp|sctp] [src|dst] port, portrange, ip/ip6 proto, less and greater, combined with and, or, not and parentheses.
+// Building with the tag "libpcap" compiles filters with libpcap instead, supporting its complete syntax.
+package filter
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+// Snap length returned by the compiled programs for matching packets
+const snapLength = 262144
+
+// Filter decides which packets are analyzed
+type Filter struct {
+	expression string
+	vm         *bpf.VM
+}
+
+// Compiles the given filter expression for packets of the given link type
+func New(expression string, linkType layers.LinkType) (*Filter, error) {
+	program, compileErr := compile(expression, linkType)
+	if compileErr != nil {
+		return nil, fmt.Errorf("unable to compile filter '%s': %s", expression, compileErr.Error())
+	}
+
+	vm, vmErr := bpf.NewVM(program)
+	if vmErr != nil {
+		return nil, fmt.Errorf("unable to load filter '%s': %s", expression, vmErr.Error())
+	}
+
+	return &Filter{
+		expression: expression,
+		vm:         vm,
+	}, nil
+}
+
+// Match returns true if the given raw packet data matches the filter
+func (f *Filter) Match(data []byte) bool {
+	verdict, runErr := f.vm.Run(data)
+	return runErr == nil && verdict > 0
+}
+
+// String returns the expression the filter was compiled from
+func (f *Filter) String() string {
+	return f.expression
+}
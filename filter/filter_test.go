@@ -0,0 +1,134 @@
+package filter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	clientMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	serverMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+// Serializes the given layers to raw packet data
+func serialize(t *testing.T, payload []byte, stack ...gopacket.SerializableLayer) []byte {
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if serializeErr := gopacket.SerializeLayers(buffer, options, append(stack, gopacket.Payload(payload))...); serializeErr != nil {
+		t.Fatalf("unable to serialize packet: %s", serializeErr)
+	}
+	return buffer.Bytes()
+}
+
+// Returns an ethernet frame carrying an IPv4 packet with the given transport layer
+func ipv4Packet(t *testing.T, src, dst string, fragOffset uint16, transport gopacket.SerializableLayer, payload []byte) []byte {
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst), FragOffset: fragOffset}
+	stack := []gopacket.SerializableLayer{&layers.Ethernet{SrcMAC: clientMAC, DstMAC: serverMAC, EthernetType: layers.EthernetTypeIPv4}, ip}
+	switch v := transport.(type) {
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		v.SetNetworkLayerForChecksum(ip)
+		stack = append(stack, v)
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		v.SetNetworkLayerForChecksum(ip)
+		stack = append(stack, v)
+	case nil:
+		ip.Protocol = layers.IPProtocolTCP
+	}
+	return serialize(t, payload, stack...)
+}
+
+// Returns an ethernet frame carrying an IPv6 packet with the given UDP header
+func ipv6Packet(t *testing.T, src, dst string, udp *layers.UDP) []byte {
+	ip := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)}
+	udp.SetNetworkLayerForChecksum(ip)
+	return serialize(t, nil, &layers.Ethernet{SrcMAC: clientMAC, DstMAC: serverMAC, EthernetType: layers.EthernetTypeIPv6}, ip, udp)
+}
+
+// Returns an ethernet frame carrying an ARP request
+func arpPacket(t *testing.T) []byte {
+	return serialize(t, nil,
+		&layers.Ethernet{SrcMAC: clientMAC, DstMAC: layers.EthernetBroadcast, EthernetType: layers.EthernetTypeARP},
+		&layers.ARP{
+			AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4,
+			Operation: layers.ARPRequest, SourceHwAddress: clientMAC, SourceProtAddress: []byte{10, 0, 0, 1},
+			DstHwAddress: make([]byte, 6), DstProtAddress: []byte{10, 0, 0, 2},
+		})
+}
+
+func TestMatch(t *testing.T) {
+	tcp := ipv4Packet(t, "10.0.0.1", "192.168.1.5", 0, &layers.TCP{SrcPort: 40000, DstPort: 80, SYN: true, Window: 1024}, nil)
+	udp := ipv4Packet(t, "10.0.0.1", "8.8.8.8", 0, &layers.UDP{SrcPort: 5353, DstPort: 53}, []byte("query"))
+	large := ipv4Packet(t, "10.0.0.1", "192.168.1.5", 0, &layers.TCP{SrcPort: 40000, DstPort: 80, ACK: true}, make([]byte, 1000))
+	// A fragment whose payload looks like a TCP header with port 80, at fragment offset 100 (800 bytes)
+	fragment := ipv4Packet(t, "10.0.0.1", "192.168.1.5", 100, nil, []byte{0x00, 0x50, 0x00, 0x50, 0, 0, 0, 0})
+	udp6 := ipv6Packet(t, "2001:db8::1", "2001:db8::53", &layers.UDP{SrcPort: 5353, DstPort: 53})
+	arp := arpPacket(t)
+
+	tests := []struct {
+		expression string
+		packet     []byte
+		match      bool
+	}{
+		{"ip", tcp, true},
+		{"ip", udp6, false},
+		{"ip6", udp6, true},
+		{"arp", arp, true},
+		{"arp", tcp, false},
+		{"tcp", tcp, true},
+		{"tcp", udp, false},
+		{"udp", udp6, true},
+		{"host 10.0.0.1", tcp, true},
+		{"host 10.0.0.2", tcp, false},
+		{"src host 10.0.0.1", tcp, true},
+		{"dst host 10.0.0.1", tcp, false},
+		{"host 2001:db8::53", udp6, true},
+		{"src host 2001:db8::53", udp6, false},
+		{"ether src host 02:00:00:00:00:01", tcp, true},
+		{"ether dst host 02:00:00:00:00:01", tcp, false},
+		{"net 192.168.0.0/16", tcp, true},
+		{"net 172.16.0.0/12", tcp, false},
+		{"net 2001:db8::/32", udp6, true},
+		{"port 80", tcp, true},
+		{"tcp port 80", tcp, true},
+		{"udp port 80", tcp, false},
+		{"dst port 53", udp, true},
+		{"src port 53", udp, false},
+		{"udp port 53", udp6, true},
+		{"portrange 50-60", udp, true},
+		{"portrange 81-443", tcp, false},
+		{"tcp port 80", fragment, false},
+		{"ip and not tcp port 80", fragment, true},
+		{"proto 17", udp, true},
+		{"ip proto \\tcp", tcp, true},
+		{"ip6 proto 17", udp6, true},
+		{"ip proto 17", udp6, false},
+		{"tcp and host 10.0.0.1", tcp, true},
+		{"tcp && host 10.0.0.2", tcp, false},
+		{"udp or arp", arp, true},
+		{"udp || arp", tcp, false},
+		{"not tcp", udp, true},
+		{"! tcp", tcp, false},
+		{"tcp and (port 22 or port 80)", tcp, true},
+		{"tcp and not (port 22 or port 80)", tcp, false},
+		{"greater 500", large, true},
+		{"greater 500", tcp, false},
+		{"less 100", tcp, true},
+		{"less 100", large, false},
+	}
+
+	for _, test := range tests {
+		f, newErr := New(test.expression, layers.LinkTypeEthernet)
+		if newErr != nil {
+			t.Errorf("%s: %s", test.expression, newErr)
+			continue
+		}
+		if match := f.Match(test.packet); match != test.match {
+			t.Errorf("%s: got match %t, expected %t", test.expression, match, test.match)
+		}
+	}
+}
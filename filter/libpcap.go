@@ -0,0 +1,25 @@
+//go:build libpcap
+// +build libpcap
+
+package filter
+
+import (
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+)
+
+// Compiles the given expression with libpcap
+func compile(expression string, linkType layers.LinkType) ([]bpf.Instruction, error) {
+	raw, compileErr := pcap.CompileBPFFilter(linkType, snapLength, expression)
+	if compileErr != nil {
+		return nil, compileErr
+	}
+
+	// Convert to the instructions understood by the VM
+	program := make([]bpf.Instruction, len(raw))
+	for i, r := range raw {
+		program[i] = bpf.RawInstruction{Op: r.Code, Jt: r.Jt, Jf: r.Jf, K: r.K}.Disassemble()
+	}
+	return program, nil
+}
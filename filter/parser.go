@@ -0,0 +1,290 @@
+//go:build !libpcap
+// +build !libpcap
+
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maride/pancap/common"
+)
+
+// A parsed filter expression, consisting of the node types below
+type expr interface{}
+
+type andExpr struct {
+	left  expr
+	right expr
+}
+
+type orExpr struct {
+	left  expr
+	right expr
+}
+
+type notExpr struct {
+	operand expr
+}
+
+// A single primitive like "tcp src port 80" or "ip6", split into its qualifiers
+type primitive struct {
+	proto string // ether, ip, ip6, arp, rarp, tcp, udp, sctp, icmp, icmp6 or empty
+	dir   string // src, dst, "src or dst", "src and dst" or empty
+	kind  string // host, net, port, portrange, proto, less, greater or empty for a bare protocol
+	id    string // the address, port, ... the primitive refers to
+}
+
+var (
+	protoQualifiers = []string{"ether", "ip", "ip6", "arp", "rarp", "tcp", "udp", "sctp", "icmp", "icmp6", "igmp"}
+	kindQualifiers  = []string{"host", "net", "port", "portrange", "proto"}
+
+	// Keywords of the tcpdump syntax which the pure-Go compiler doesn't support
+	unsupportedKeywords = []string{
+		"vlan", "mpls", "pppoed", "pppoes", "geneve", "broadcast", "multicast", "gateway", "len",
+		"inbound", "outbound", "ifname", "on", "rnr", "rulenum", "reason", "rset", "srnr", "subrulenum", "action",
+		"wlan", "type", "subtype", "dir", "addr1", "addr2", "addr3", "addr4", "ra", "ta",
+		"llc", "decnet", "iso", "esis", "isis", "clnp", "stp", "ipx", "netbeui", "atalk", "aarp", "lat", "moprc", "mopdl",
+		"fddi", "tr", "ah", "esp", "vrrp", "carp", "pim", "igrp",
+	}
+)
+
+// Holds the state while parsing an expression
+type parser struct {
+	tokens []string
+	pos    int
+	// Qualifiers of the last primitive, used for abbreviations like "port 80 or 443"
+	last primitive
+}
+
+// Parses the given filter expression
+func parse(expression string) (expr, error) {
+	p := &parser{tokens: tokenize(expression)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+
+	tree, parseErr := p.parseOr()
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if p.pos < len(p.tokens) {
+		return nil, unexpected(p.tokens[p.pos])
+	}
+	return tree, nil
+}
+
+// Splits the expression into words, parentheses and operators
+func tokenize(expression string) []string {
+	var tokens []string
+	word := ""
+
+	flush := func() {
+		if word != "" {
+			tokens = append(tokens, word)
+			word = ""
+		}
+	}
+
+	for i := 0; i < len(expression); i++ {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		case c == '(' || c == ')' || c == '!':
+			flush()
+			tokens = append(tokens, string(c))
+		case (c == '&' || c == '|') && i+1 < len(expression) && expression[i+1] == c:
+			flush()
+			tokens = append(tokens, string([]byte{c, c}))
+			i++
+		default:
+			word += string(c)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// Returns the current token, or an empty string at the end of the expression
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// Returns the token after the current one, or an empty string
+func (p *parser) peekAt(offset int) string {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return ""
+}
+
+// Returns the current token and advances to the next one
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// or := and { ("or" | "||") and }
+func (p *parser) parseOr() (expr, error) {
+	left, leftErr := p.parseAnd()
+	if leftErr != nil {
+		return nil, leftErr
+	}
+
+	for p.peek() == "or" || p.peek() == "||" {
+		p.next()
+		right, rightErr := p.parseAnd()
+		if rightErr != nil {
+			return nil, rightErr
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+// and := not { ("and" | "&&") not }
+func (p *parser) parseAnd() (expr, error) {
+	left, leftErr := p.parseNot()
+	if leftErr != nil {
+		return nil, leftErr
+	}
+
+	for p.peek() == "and" || p.peek() == "&&" {
+		p.next()
+		right, rightErr := p.parseNot()
+		if rightErr != nil {
+			return nil, rightErr
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+// not := ("not" | "!") not | "(" or ")" | primitive
+func (p *parser) parseNot() (expr, error) {
+	switch p.peek() {
+	case "not", "!":
+		p.next()
+		operand, operandErr := p.parseNot()
+		if operandErr != nil {
+			return nil, operandErr
+		}
+		return notExpr{operand}, nil
+	case "(":
+		p.next()
+		inner, innerErr := p.parseOr()
+		if innerErr != nil {
+			return nil, innerErr
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		return inner, nil
+	}
+
+	return p.parsePrimitive()
+}
+
+// primitive := ("less" | "greater") id | [proto] [dir] [kind] id | proto
+func (p *parser) parsePrimitive() (expr, error) {
+	var prim primitive
+	if isUnsupported(p.peek()) {
+		return nil, unsupported(p.peek())
+	}
+
+	// Check for the primitives without qualifiers
+	if p.peek() == "less" || p.peek() == "greater" {
+		prim.kind = p.next()
+		return p.parseID(prim)
+	}
+
+	// Read all qualifiers given
+	if common.Contains(protoQualifiers, p.peek()) {
+		prim.proto = p.next()
+	}
+	if p.peek() == "src" || p.peek() == "dst" {
+		prim.dir = p.next()
+		// Check for "src or dst" and "src and dst"
+		if prim.dir == "src" && (p.peek() == "or" || p.peek() == "and") && p.peekAt(1) == "dst" {
+			prim.dir = "src " + p.next() + " dst"
+			p.next()
+		}
+	}
+	if common.Contains(kindQualifiers, p.peek()) {
+		prim.kind = p.next()
+	}
+
+	switch {
+	case prim.proto == "" && prim.dir == "" && prim.kind == "":
+		// No qualifiers at all - either an abbreviation like "port 80 or 443", or a plain host
+		if !isID(p.peek()) {
+			return nil, unexpected(p.peek())
+		}
+		prim = p.last
+		if prim.kind == "" {
+			prim = primitive{kind: "host"}
+		}
+	case prim.kind == "" && prim.dir == "" && !isID(p.peek()):
+		// A bare protocol like "tcp"
+		return prim, nil
+	case prim.kind == "":
+		// Qualifiers without a kind default to host, e.g. "src 10.0.0.1" or "ether dst aa:bb:cc:dd:ee:ff"
+		prim.kind = "host"
+	}
+
+	return p.parseID(prim)
+}
+
+// Reads the id of the given primitive
+func (p *parser) parseID(prim primitive) (expr, error) {
+	if isUnsupported(p.peek()) {
+		return nil, unsupported(p.peek())
+	}
+	if !isID(p.peek()) {
+		return nil, unexpected(p.peek())
+	}
+	prim.id = p.next()
+
+	p.last = prim
+	return prim, nil
+}
+
+// Checks if the given token can be an id, i.e. isn't an operator or keyword
+func isID(token string) bool {
+	switch token {
+	case "", "(", ")", "!", "&&", "||", "and", "or", "not", "src", "dst", "less", "greater":
+		return false
+	}
+	return !common.Contains(kindQualifiers, token)
+}
+
+// Checks if the given token is valid tcpdump syntax the pure-Go compiler doesn't support,
+// i.e. a keyword like "vlan", packet data access like "tcp[13]" or an arithmetic or relational operator
+func isUnsupported(token string) bool {
+	if common.Contains(unsupportedKeywords, token) || strings.Contains(token, "[") {
+		return true
+	}
+	return token != "" && strings.Trim(token, "&|=<>+-*/%^") == ""
+}
+
+// Returns the error for an unexpected token
+func unexpected(token string) error {
+	if token == "" {
+		return fmt.Errorf("unexpected end of filter")
+	}
+	if isUnsupported(token) {
+		return unsupported(token)
+	}
+	return fmt.Errorf("unexpected '%s'", token)
+}
+
+// Returns the error for valid syntax the pure-Go compiler doesn't support
+func unsupported(token string) error {
+	return fmt.Errorf("unsupported primitive '%s', build pancap with the libpcap tag for the complete filter syntax", token)
+}
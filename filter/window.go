@@ -0,0 +1,111 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window restricts an analysis to the packets captured in a span of time.
+// Both ends are optional, and may either be absolute or relative to the start of the capture.
+type Window struct {
+	from bound
+	to   bound
+}
+
+// A single end of a window
+type bound struct {
+	set      bool
+	absolute time.Time
+	offset   time.Duration
+	relative bool
+}
+
+// Creates a window from the given ends, each either an RFC3339 timestamp like "2020-01-01T12:00:00Z",
+// an offset from the start of the capture like "1h30m", or an empty string for an open end.
+func NewWindow(from string, to string) (*Window, error) {
+	fromBound, fromErr := parseBound(from)
+	if fromErr != nil {
+		return nil, fromErr
+	}
+	toBound, toErr := parseBound(to)
+	if toErr != nil {
+		return nil, toErr
+	}
+
+	// Check if the window is the right way around, at least if we can tell already
+	if fromBound.set && toBound.set && fromBound.relative == toBound.relative {
+		if (fromBound.relative && toBound.offset < fromBound.offset) || (!fromBound.relative && toBound.absolute.Before(fromBound.absolute)) {
+			return nil, fmt.Errorf("end of time window (%s) is before its start (%s)", to, from)
+		}
+	}
+
+	return &Window{
+		from: fromBound,
+		to:   toBound,
+	}, nil
+}
+
+// Parses a single end of a window
+func parseBound(value string) (bound, error) {
+	if value == "" {
+		return bound{}, nil
+	}
+
+	// Check if this is an offset from the start of the capture
+	if offset, parseErr := time.ParseDuration(strings.TrimPrefix(value, "+")); parseErr == nil {
+		if offset < 0 {
+			return bound{}, fmt.Errorf("offset '%s' is negative, offsets are counted from the start of the capture", value)
+		}
+		return bound{set: true, offset: offset, relative: true}, nil
+	}
+
+	absolute, parseErr := time.Parse(time.RFC3339Nano, value)
+	if parseErr != nil {
+		return bound{}, fmt.Errorf("'%s' is neither an RFC3339 timestamp nor an offset like 5m", value)
+	}
+	return bound{set: true, absolute: absolute}, nil
+}
+
+// Returns the time the bound refers to, for a capture started at the given time
+func (b bound) resolve(start time.Time) time.Time {
+	if b.relative {
+		return start.Add(b.offset)
+	}
+	return b.absolute
+}
+
+// Contains returns true if the given timestamp lies inside the window.
+// start is the timestamp of the first packet of the capture, which offsets are relative to.
+func (w *Window) Contains(timestamp time.Time, start time.Time) bool {
+	if w.from.set && timestamp.Before(w.from.resolve(start)) {
+		return false
+	}
+	return !w.Ended(timestamp, start)
+}
+
+// Ended returns true if the given timestamp lies past the end of the window.
+// If packets are read in timestamp order, none of the following packets are inside the window either.
+func (w *Window) Ended(timestamp time.Time, start time.Time) bool {
+	return w.to.set && timestamp.After(w.to.resolve(start))
+}
+
+// String returns the window as given by the user, e.g. "from 5m to 10m"
+func (w *Window) String() string {
+	var parts []string
+	if w.from.set {
+		parts = append(parts, "from "+w.from.String())
+	}
+	if w.to.set {
+		parts = append(parts, "to "+w.to.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// String returns the bound as given by the user
+func (b bound) String() string {
+	if b.relative {
+		return "+" + b.offset.String()
+	}
+	return b.absolute.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,66 @@
+package filter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewWindow(t *testing.T) {
+	tests := []struct {
+		from, to string
+		valid    bool
+	}{
+		{"", "", true},
+		{"5m", "", true},
+		{"+5m", "10m", true},
+		{"", "2020-01-01T12:00:00Z", true},
+		{"2020-01-01T12:00:00Z", "2020-01-01T12:00:00.5Z", true},
+		{"10m", "5m", false},
+		{"2020-01-01T12:00:00Z", "2020-01-01T11:00:00Z", false},
+		{"-5m", "", false},
+		{"", "-1s", false},
+		{"yesterday", "", false},
+	}
+
+	for _, test := range tests {
+		_, windowErr := NewWindow(test.from, test.to)
+		if (windowErr == nil) != test.valid {
+			t.Errorf("from '%s' to '%s': got error %v, expected valid %t", test.from, test.to, windowErr, test.valid)
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		from, to string
+		offset   time.Duration
+		contains bool
+		ended    bool
+	}{
+		{"", "", time.Hour, true, false},
+		{"5m", "10m", 4 * time.Minute, false, false},
+		{"5m", "10m", 5 * time.Minute, true, false},
+		{"5m", "10m", 10 * time.Minute, true, false},
+		{"5m", "10m", 11 * time.Minute, false, true},
+		{"2020-01-01T12:05:00Z", "", 4 * time.Minute, false, false},
+		{"2020-01-01T12:05:00Z", "", time.Hour, true, false},
+		{"", "2020-01-01T12:10:00Z", time.Minute, true, false},
+		{"", "2020-01-01T12:10:00Z", time.Hour, false, true},
+	}
+
+	for _, test := range tests {
+		w, windowErr := NewWindow(test.from, test.to)
+		if windowErr != nil {
+			t.Fatalf("from '%s' to '%s': %s", test.from, test.to, windowErr)
+		}
+		timestamp := start.Add(test.offset)
+		if contains := w.Contains(timestamp, start); contains != test.contains {
+			t.Errorf("%s at %s: got contains %t, expected %t", w, test.offset, contains, test.contains)
+		}
+		if ended := w.Ended(timestamp, start); ended != test.ended {
+			t.Errorf("%s at %s: got ended %t, expected %t", w, test.offset, ended, test.ended)
+		}
+	}
+}
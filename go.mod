@@ -5,7 +5,9 @@ go 1.13
 require (
 	github.com/fatih/color v1.7.0
 	github.com/google/gopacket v1.1.17
+	github.com/klauspost/compress v1.11.13
 	github.com/mattn/go-colorable v0.1.4 // indirect
-	github.com/mattn/go-isatty v0.0.10 // indirect
+	github.com/mattn/go-isatty v0.0.10
+	github.com/ulikunitz/xz v0.5.15
 	golang.org/x/net v0.0.0-20191126235420-ef20fe5d7933
 )
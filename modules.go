@@ -0,0 +1,22 @@
+package pancap
+
+import (
+	"github.com/maride/pancap/protocol"
+
+	// Protocol modules register themselves when imported
+	_ "github.com/maride/pancap/protocol/arp"
+	_ "github.com/maride/pancap/protocol/conversations"
+	_ "github.com/maride/pancap/protocol/dhcpv4"
+	_ "github.com/maride/pancap/protocol/dns"
+	_ "github.com/maride/pancap/protocol/hierarchy"
+	_ "github.com/maride/pancap/protocol/http"
+	_ "github.com/maride/pancap/protocol/usbkeyboard"
+	_ "github.com/maride/pancap/protocol/usbmouse"
+	_ "github.com/maride/pancap/protocol/usbstorage"
+	_ "github.com/maride/pancap/protocol/wireless"
+)
+
+// Returns all available protocol modules
+func Modules() []protocol.Module {
+	return protocol.Modules()
+}
@@ -0,0 +1,152 @@
+package output
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/maride/pancap/common"
+)
+
+// Block is a named section of the report, e.g. the summary of a module.
+// Span is the time span of the packets the block is based on, if known.
+type Block struct {
+	Headline string `json:"headline"`
+	Span     *Span  `json:"span,omitempty"`
+	Items    []Item `json:"items"`
+}
+
+// ErrorsHeadline is the headline of the block summarizing the errors encountered by the modules
+const ErrorsHeadline = "Module errors"
+
+// Span is the time between the first and the last packet of a set of packets
+type Span struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Item is a single piece of information inside a block.
+// The output package knows how to render each of the item types defined below.
+type Item interface {
+	Kind() string
+}
+
+// Text is a single line of free text
+type Text struct {
+	Line string `json:"line"`
+}
+
+// Count is a named number, rendered as "<value> <label>"
+type Count struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+	Label string `json:"label"`
+}
+
+// Property is a named value, rendered as "<name>: <value>"
+// An empty value is rendered as "(not found)".
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// List is a titled list of entries, rendered as a tree
+type List struct {
+	Title   string   `json:"title,omitempty"`
+	Entries []string `json:"entries"`
+}
+
+// Table holds typed rows, one value per column
+type Table struct {
+	Title   string          `json:"title,omitempty"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// Tree is a titled, nested tree of entries.
+// If columns are given, the first one names the labels, and the others the values of the nodes.
+type Tree struct {
+	Title   string            `json:"title,omitempty"`
+	Columns []string          `json:"columns,omitempty"`
+	Nodes   []common.TreeNode `json:"nodes"`
+}
+
+// Finding is something noteworthy a module stumbled upon, e.g. possible ARP spoofing.
+// Source is the capture file the finding came from, if several files were analyzed.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Source   string   `json:"source,omitempty"`
+}
+
+// Severity classifies a finding
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+)
+
+func (Text) Kind() string     { return "text" }
+func (Count) Kind() string    { return "count" }
+func (Property) Kind() string { return "property" }
+func (List) Kind() string     { return "list" }
+func (Table) Kind() string    { return "table" }
+func (Tree) Kind() string     { return "tree" }
+func (Finding) Kind() string  { return "finding" }
+
+// Add appends the given items to the block.
+// Lists, tables and trees without any entries are skipped, so that they don't show up as empty sections.
+func (b *Block) Add(items ...Item) {
+	for _, i := range items {
+		switch v := i.(type) {
+		case List:
+			if len(v.Entries) == 0 {
+				continue
+			}
+		case Table:
+			if len(v.Rows) == 0 {
+				continue
+			}
+		case Tree:
+			if len(v.Nodes) == 0 {
+				continue
+			}
+		}
+		b.Items = append(b.Items, i)
+	}
+}
+
+// AddRow appends a row to the table
+func (t *Table) AddRow(values ...interface{}) {
+	t.Rows = append(t.Rows, values)
+}
+
+// Extend widens the span to include the given time
+func (s *Span) Extend(t time.Time) {
+	if s.From.IsZero() || t.Before(s.From) {
+		s.From = t
+	}
+	if s.To.IsZero() || t.After(s.To) {
+		s.To = t
+	}
+}
+
+// IsEmpty returns true if the span doesn't include any time yet
+func (s *Span) IsEmpty() bool {
+	return s.From.IsZero()
+}
+
+// String returns the span in a human-readable way, e.g. "2020-01-01 12:00:00 to 12:05:00 (5m0s)"
+func (s Span) String() string {
+	to := s.To.Format("2006-01-02 15:04:05")
+	if s.From.Format("2006-01-02") == s.To.Format("2006-01-02") {
+		// Same day, no need to repeat the date
+		to = s.To.Format("15:04:05")
+	}
+	return fmt.Sprintf("%s to %s (%s)", s.From.Format("2006-01-02 15:04:05"), to, s.To.Sub(s.From).Round(time.Second))
+}
+
+// IsEmpty returns true if the block doesn't contain anything to show
+func (b *Block) IsEmpty() bool {
+	return len(b.Items) == 0
+}
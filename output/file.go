@@ -10,6 +10,7 @@ type File struct {
 	content []byte
 	origin  string
 	hash    string
+	path    string
 }
 
 // Creates a new file object and calculates the hash of the given content
@@ -22,3 +23,28 @@ func NewFile(name string, content []byte, origin string) File {
 		hash:    hash,
 	}
 }
+
+// Name returns the name of the file, if one was found
+func (f *File) Name() string {
+	return f.name
+}
+
+// Content returns the content of the file
+func (f *File) Content() []byte {
+	return f.content
+}
+
+// Origin returns a descriptive string where the file comes from, e.g. the module name
+func (f *File) Origin() string {
+	return f.origin
+}
+
+// Hash returns the (shortened) hash identifying the file
+func (f *File) Hash() string {
+	return f.hash
+}
+
+// Path returns the path the file was extracted to, or an empty string if it wasn't extracted
+func (f *File) Path() string {
+	return f.path
+}
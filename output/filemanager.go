@@ -6,56 +6,80 @@ import (
 	"log"
 	"os"
 	"strings"
-
-	"github.com/maride/pancap/common"
+	"sync"
 )
 
-var (
-	registeredFiles []File
+// Headline of the block summarizing the files
+const filesHeadline = "Files"
+
+// FileManager keeps track of all files found by the modules of a single analysis
+type FileManager struct {
+	lock            sync.Mutex
+	registeredFiles []*File
 	notFound        []string
 	extractedFiles  int
-)
+}
+
+// Creates a new, empty file manager
+func NewFileManager() *FileManager {
+	return &FileManager{}
+}
 
 // Registers a file with the given name and content.
 // This function takes care of filesystem I/O handling and flag parsing.
 // This means that a module should _always_ call this function when a file is encountered.
 // origin is a descriptive string where the file comes from, e.g. the module name.
-func RegisterFile(filename string, content []byte, origin string) {
+// Returns the hash the file is known by, e.g. as name of the extracted file, or an empty string if it is empty.
+func (fm *FileManager) RegisterFile(filename string, content []byte, origin string) string {
 	// Check if there even is anything to register
 	if len(content) == 0 {
 		// File is empty, won't register the void
 		log.Printf("Avoided registering file from %s because it is empty.", origin)
-		return
+		return ""
 	}
 	thisFile := NewFile(filename, content, origin)
+
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+
 	// To avoid doubles, we need to check if that hash is already present
-	for _, f := range registeredFiles {
+	for _, f := range fm.registeredFiles {
 		if f.hash == thisFile.hash {
 			// Found - stop here
 			log.Printf("Avoided registering file from %s because it has the same content as an already registered file ", origin)
-			return
+			return f.hash
 		}
 	}
 
 	// None found, add to list
-	registeredFiles = append(registeredFiles, thisFile)
+	fm.registeredFiles = append(fm.registeredFiles, &thisFile)
+	return thisFile.hash
+}
+
+// Returns all registered files
+func (fm *FileManager) Files() []*File {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+	return fm.registeredFiles
 }
 
-// Iterates over all registered files and checks if they should be extracted and stored, and does exactly that.
-func StoreFiles() {
-	var filesToExtract []File
+// Stores the registered files in the given directory - either all of them, or those with the given hashes.
+func (fm *FileManager) StoreFiles(all bool, hashes []string, directory string) {
+	var filesToExtract []*File
 
-	// Check different flag scenarios
-	if targetAllFiles {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+
+	// Check different scenarios
+	if all {
 		// We should extract all files.
-		filesToExtract = registeredFiles
+		filesToExtract = fm.registeredFiles
 	} else {
 		// We should extract only a given set of files
-		fileList := strings.Split(targetFiles, ",")
-		for _, f := range fileList {
+		for _, f := range hashes {
 			// Iterate over desired files
 			found := false
-			for _, a := range registeredFiles {
+			for _, a := range fm.registeredFiles {
 				// Iterate over available (registered) files
 				if f == a.hash {
 					// Found the file
@@ -67,20 +91,20 @@ func StoreFiles() {
 
 			if !found {
 				// No file found, notify user
-				notFound = append(notFound, fmt.Sprintf("File with hash %s requested but not found.", f))
+				fm.notFound = append(fm.notFound, fmt.Sprintf("File with hash %s requested but not found.", f))
 			}
 		}
 	}
 
 	// Iterate over all target files and write it them out
 	for _, f := range filesToExtract {
-		writeOut(f)
+		fm.writeOut(f, directory)
 	}
 }
 
 // Writes the given file object to disk, along with a stats file placed next to it.
-func writeOut(f File) {
-	targetName := fmt.Sprintf("%s%c%s", targetOutput, os.PathSeparator, f.hash)
+func (fm *FileManager) writeOut(f *File, directory string) {
+	targetName := fmt.Sprintf("%s%c%s", directory, os.PathSeparator, f.hash)
 	targetDescName := fmt.Sprintf("%s.info", targetName)
 	targetDescription := fmt.Sprintf("Filename: %s\nHash: %s\nOrigin: %s\nSize: %d", f.name, f.hash, f.origin, len(f.content))
 
@@ -98,17 +122,25 @@ func writeOut(f File) {
 		return
 	}
 
-	// Raise stats
-	extractedFiles++
+	// Raise stats and remember where we stored the file
+	fm.extractedFiles++
+	f.path = targetName
 }
 
-// Prints a brief summary about the extracted files
-func PrintSummary() {
-	summary := fmt.Sprintf("%d files found in stream.\n%d files extracted from stream.", len(registeredFiles), extractedFiles)
+// Returns a brief summary about the extracted files
+func (fm *FileManager) Summary() Block {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+
+	block := Block{Headline: filesHeadline}
+	block.Add(
+		Count{Name: "found", Value: len(fm.registeredFiles), Label: "files found in stream."},
+		Count{Name: "extracted", Value: fm.extractedFiles, Label: "files extracted from stream."},
+	)
 
 	// Generate list of found files
 	var strFileList []string
-	for _, f := range registeredFiles {
+	for _, f := range fm.registeredFiles {
 		name := f.name
 		if name == "" {
 			name = "(no name found)"
@@ -117,17 +149,13 @@ func PrintSummary() {
 		strFileList = append(strFileList, fmt.Sprintf("%s: %s (%s), %d bytes", f.hash, name, f.origin, len(f.content)))
 	}
 
-	// Print list of files as a tree
-	if len(strFileList) > 0 {
-		summary += "\nFound files:"
-		summary += "\n" + common.GenerateTree(strFileList)
-	}
+	// Add list of files
+	block.Add(List{Title: "Found files", Entries: strFileList})
 
 	// Check if we left a few requested files unanswered
-	if len(notFound) > 0 {
-		summary += "\nUnable to find requested file(s) " + strings.Join(notFound, ", ")
+	if len(fm.notFound) > 0 {
+		block.Add(Text{Line: "Unable to find requested file(s) " + strings.Join(fm.notFound, ", ")})
 	}
 
-	// Print constructed summary
-	PrintBlock("Files", summary)
+	return block
 }
@@ -1,21 +1,43 @@
 package output
 
-import "flag"
+import (
+	"flag"
+	"fmt"
+)
 
 var (
 	fullOutput       bool
 	printEmptyBlocks bool
-	targetFiles      string
-	targetAllFiles   bool
-	targetOutput     string
 	graphOutput      string
+	formatFlag       string
+	jsonOutput       string
+	htmlOutput       string
 )
 
 func RegisterFlags() {
 	flag.BoolVar(&fullOutput, "full-output", false, "Show full output instead of limiting submodule output")
 	flag.BoolVar(&printEmptyBlocks, "print-empty-blocks", false, "Prints blocks (submodule output) even if the submodule doesn't have any content to print.")
-	flag.StringVar(&targetFiles, "extract-these", "", "Comma-separated list of files to extract.")
-	flag.BoolVar(&targetAllFiles, "extract-all", false, "Extract all files found.")
-	flag.StringVar(&targetOutput, "extract-to", "./extracted", "Directory to store extracted files in.")
 	flag.StringVar(&graphOutput, "create-graph", "", "Create a Graphviz graph out of collected communication")
+	flag.StringVar(&formatFlag, "format", "text", "Output format, either 'text' or 'json'")
+	flag.StringVar(&jsonOutput, "json-out", "", "Additionally write the report as JSON document to the given file")
+	flag.StringVar(&htmlOutput, "html-out", "", "Additionally write the report as self-contained HTML file")
+}
+
+// Checks the given flags for invalid values
+func CheckFlags() error {
+	if formatFlag != "text" && formatFlag != "json" {
+		return fmt.Errorf("unknown output format '%s', expected 'text' or 'json'", formatFlag)
+	}
+	return nil
+}
+
+// Returns true if the report is printed as human-readable text.
+// Other output to stdout, e.g. the MOTD, should be avoided if this isn't the case.
+func TextMode() bool {
+	return formatFlag == "text"
+}
+
+// FullOutput returns true if the user asked for the full output, instead of cutting it
+func FullOutput() bool {
+	return fullOutput
 }
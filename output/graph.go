@@ -3,71 +3,74 @@ package output
 import (
 	"crypto/sha256"
 	"fmt"
+	"html"
 	"io/ioutil"
+	"math"
+	"strings"
 
-	"github.com/google/gopacket"
+	"github.com/maride/pancap/common"
 )
 
-var graphPkgs []GraphPkg
-
-// AddPkgToGraph adds the given packet as communication to the graph
-func AddPkgToGraph(pkg gopacket.Packet) {
-	// Only proceed if pkg contains a network layer
-	if pkg.NetworkLayer() == nil {
-		return
-	}
+// Graph collects the communication of a single analysis
+type Graph struct {
+	graphPkgs []GraphPkg
+}
 
-	src := pkg.NetworkLayer().NetworkFlow().Src().String()
-	dst := pkg.NetworkLayer().NetworkFlow().Dst().String()
+// Creates a new, empty graph
+func NewGraph() *Graph {
+	return &Graph{}
+}
 
+// AddFlow adds the communication from one address to another to the graph, along with the spoken protocol, e.g. "TCP/80"
+func (g *Graph) AddFlow(from string, to string, protocol string) {
 	// Search for the given communication pair
-	for _, p := range graphPkgs {
-		if p.from == src && p.to == dst {
+	for i := range g.graphPkgs {
+		if g.graphPkgs[i].from == from && g.graphPkgs[i].to == to {
 			// Communication pair found, add protocol and finish
-			p.AddProtocol("nil")
+			g.graphPkgs[i].AddProtocol(protocol)
 			return
 		}
 	}
 
 	// Communcation pair was not in graphPkgs, add to it
-	graphPkgs = append(graphPkgs, GraphPkg{
-		from:     src,
-		to:       dst,
-		protocol: []string{""},
+	g.graphPkgs = append(g.graphPkgs, GraphPkg{
+		from:     from,
+		to:       to,
+		protocol: []string{protocol},
 	})
 }
 
-// CreateGraph writes out a Graphviz digraph
-func CreateGraph() {
-	if graphOutput == "" {
-		// No graph requested
-		return
-	}
+// IsEmpty returns true if no communication was collected
+func (g *Graph) IsEmpty() bool {
+	return len(g.graphPkgs) == 0
+}
 
+// CreateGraph writes out a Graphviz digraph to the given file
+func (g *Graph) CreateGraph(filename string) error {
 	// Start with the Graphviz-specific header
-	dot := fmt.Sprintf("# Compile with `neato -Tpng %s > %s.png`\n", graphOutput, graphOutput)
+	dot := fmt.Sprintf("# Compile with `neato -Tpng %s > %s.png`\n", filename, filename)
 	dot += "digraph pancap {\n\toverlap = false;\n"
 
 	// First, gather all nodes as-is and write them out
-	dot += nodedef(graphPkgs)
+	dot += nodedef(g.graphPkgs)
 
 	// Iterate over communication
-	for _, p := range graphPkgs {
-		dot += fmt.Sprintf("\tn%s->n%s\n", hash(p.from), hash(p.to))
+	for _, p := range g.graphPkgs {
+		dot += fmt.Sprintf("\tn%s->n%s[label=\"%s\"]\n", hash(p.from), hash(p.to), strings.Join(p.protocol, ", "))
 	}
 
 	// Close
 	dot += "}\n"
 
 	// Write out
-	ioutil.WriteFile(graphOutput, []byte(dot), 0644)
+	return ioutil.WriteFile(filename, []byte(dot), 0644)
 }
 
 // Creates a list of distinct nodes, Graphviz-compatible
 func nodedef(pkgs []GraphPkg) string {
 	output := ""
 	nodes := []string{}
-	for _, p := range graphPkgs {
+	for _, p := range pkgs {
 		// Check if src and dst are already present in nodes array
 		srcFound := false
 		dstFound := false
@@ -98,6 +101,42 @@ func nodedef(pkgs []GraphPkg) string {
 	return output
 }
 
+// Renders the collected communication as SVG image, with all nodes placed on a circle
+func (g *Graph) SVG() string {
+	if g.IsEmpty() {
+		return ""
+	}
+
+	// Gather distinct nodes and place them
+	var nodes []string
+	for _, p := range g.graphPkgs {
+		nodes = common.AppendIfUnique(p.from, nodes)
+		nodes = common.AppendIfUnique(p.to, nodes)
+	}
+	radius := math.Max(150, float64(len(nodes))*15)
+	size := 2*radius + 300
+	pos := make(map[string][2]float64)
+	for i, n := range nodes {
+		angle := 2 * math.Pi * float64(i) / float64(len(nodes))
+		pos[n] = [2]float64{size/2 + radius*math.Cos(angle), size/2 + radius*math.Sin(angle)}
+	}
+
+	svg := fmt.Sprintf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" font-family=\"sans-serif\" font-size=\"11\">\n", size, size)
+	svg += "<defs><marker id=\"arrow\" viewBox=\"0 0 10 10\" refX=\"14\" refY=\"5\" markerWidth=\"6\" markerHeight=\"6\" orient=\"auto\"><path d=\"M0,0 L10,5 L0,10 z\" fill=\"#888\"/></marker></defs>\n"
+
+	// Draw communication first, so nodes are drawn on top of it
+	for _, p := range g.graphPkgs {
+		from, to := pos[p.from], pos[p.to]
+		svg += fmt.Sprintf("<line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"#888\" marker-end=\"url(#arrow)\"><title>%s</title></line>\n", from[0], from[1], to[0], to[1], html.EscapeString(strings.Join(p.protocol, ", ")))
+	}
+	for _, n := range nodes {
+		svg += fmt.Sprintf("<circle cx=\"%.1f\" cy=\"%.1f\" r=\"5\" fill=\"#b00\"/>\n", pos[n][0], pos[n][1])
+		svg += fmt.Sprintf("<text x=\"%.1f\" y=\"%.1f\">%s</text>\n", pos[n][0]+8, pos[n][1]-8, html.EscapeString(n))
+	}
+
+	return svg + "</svg>\n"
+}
+
 func hash(s string) string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))[:6]
 }
@@ -0,0 +1,263 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/maride/pancap/common"
+)
+
+// A block, already rendered as HTML
+type htmlSection struct {
+	Headline string
+	Span     *Span
+	Body     template.HTML
+}
+
+// A registered file, along with the relative link to it if it was extracted
+type htmlFile struct {
+	Hash   string
+	Name   string
+	Origin string
+	Size   int
+	Link   string
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join": func(s []string) string { return strings.Join(s, ", ") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pancap report{{if .Capture.Files}} for {{join .Capture.Files}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+summary { font-size: 1.2em; font-weight: bold; color: #b00; cursor: pointer; margin-top: 1em; }
+details > div { margin-left: 1.5em; }
+table { border-collapse: collapse; margin: 0.5em 0; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+th { background: #eee; cursor: pointer; }
+.finding { font-weight: bold; }
+.finding.warning { color: #c60; }
+.missing { color: #b00; }
+.span { color: #777; }
+</style>
+</head>
+<body>
+<h1>pancap report</h1>
+<p>{{if .Capture.Files}}File {{join .Capture.Files}}, {{end}}link type {{.Capture.LinkType}} (ID {{.Capture.LinkTypeID}})</p>
+{{range .Sections}}<details open>
+<summary>{{.Headline}}</summary>
+<div>{{if .Span}}<p class="span">Covering {{.Span}}</p>
+{{end}}{{.Body}}</div>
+</details>
+{{end}}{{if .Files}}<details open>
+<summary>Files</summary>
+<div><table class="sortable">
+<tr><th>Hash</th><th>Name</th><th>Origin</th><th>Size</th></tr>
+{{range .Files}}<tr><td>{{if .Link}}<a href="{{.Link}}">{{.Hash}}</a>{{else}}{{.Hash}}{{end}}</td><td>{{.Name}}</td><td>{{.Origin}}</td><td>{{.Size}}</td></tr>
+{{end}}</table></div>
+</details>
+{{end}}{{if .Graph}}<details open>
+<summary>Communication graph</summary>
+<div>{{.Graph}}</div>
+</details>
+{{end}}<script>
+// Sort tables by the clicked column, numerically if possible
+document.querySelectorAll("table.sortable th").forEach(function(th) {
+	th.addEventListener("click", function() {
+		var table = th.closest("table");
+		var index = Array.prototype.indexOf.call(th.parentNode.children, th);
+		var rows = Array.prototype.slice.call(table.querySelectorAll("tr")).slice(1);
+		var asc = th.dataset.order !== "asc";
+		th.dataset.order = asc ? "asc" : "desc";
+		rows.sort(function(a, b) {
+			var x = a.children[index].textContent, y = b.children[index].textContent;
+			var nx = parseFloat(x), ny = parseFloat(y);
+			var cmp = (!isNaN(nx) && !isNaN(ny)) ? nx - ny : x.localeCompare(y);
+			return asc ? cmp : -cmp;
+		});
+		rows.forEach(function(r) { r.parentNode.appendChild(r); });
+	});
+});
+</script>
+</body>
+</html>
+`))
+
+// Writes the given report as a single, self-contained HTML file.
+// Unlike the terminal output, blocks are never cut.
+func writeHTML(report Report, filename string) error {
+	data := struct {
+		Capture  Capture
+		Sections []htmlSection
+		Files    []htmlFile
+		Graph    template.HTML
+	}{
+		Capture: report.Capture,
+	}
+	if report.Graph != nil {
+		data.Graph = template.HTML(report.Graph.SVG())
+	}
+
+	// Render all blocks, except the file summary - files are listed with links to them below
+	for _, b := range report.Blocks {
+		if b.Headline == filesHeadline {
+			continue
+		}
+		if b.IsEmpty() && !printEmptyBlocks {
+			continue
+		}
+		data.Sections = append(data.Sections, htmlSection{
+			Headline: b.Headline,
+			Span:     b.Span,
+			Body:     template.HTML(renderHTMLBlock(b)),
+		})
+	}
+
+	// Collect files, linking to them relative to the HTML file if they were extracted
+	for _, f := range report.Files {
+		hf := htmlFile{
+			Hash:   f.hash,
+			Name:   f.name,
+			Origin: f.origin,
+			Size:   len(f.content),
+		}
+		if f.path != "" {
+			hf.Link = filepath.ToSlash(relativePath(filepath.Dir(filename), f.path))
+		}
+		data.Files = append(data.Files, hf)
+	}
+
+	var buf bytes.Buffer
+	if execErr := htmlTemplate.Execute(&buf, data); execErr != nil {
+		return execErr
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// Returns path relative to base, or path itself if that's not possible
+func relativePath(base string, path string) string {
+	absBase, baseErr := filepath.Abs(base)
+	absPath, pathErr := filepath.Abs(path)
+	if baseErr != nil || pathErr != nil {
+		return path
+	}
+
+	rel, relErr := filepath.Rel(absBase, absPath)
+	if relErr != nil {
+		return path
+	}
+	return rel
+}
+
+// Renders the items of the given block as HTML
+func renderHTMLBlock(b Block) string {
+	content := ""
+	for _, i := range b.Items {
+		content += renderHTMLItem(i)
+	}
+	return content
+}
+
+// Renders the given nodes as nested HTML list
+func renderHTMLTree(nodes []common.TreeNode) string {
+	content := "<ul>\n"
+	for _, n := range nodes {
+		content += fmt.Sprintf("<li>%s", html.EscapeString(n.Label))
+		if len(n.Children) > 0 {
+			content += "\n" + renderHTMLTree(n.Children)
+		}
+		content += "</li>\n"
+	}
+	return content + "</ul>\n"
+}
+
+// Renders the given nodes as rows of a table, indenting the labels by their depth
+func renderHTMLTreeRows(nodes []common.TreeNode, depth int) string {
+	content := ""
+	for _, n := range nodes {
+		content += fmt.Sprintf("<tr><td style=\"padding-left: %.1fem\">%s</td>", 0.6+1.5*float64(depth), html.EscapeString(n.Label))
+		for _, v := range n.Values {
+			content += fmt.Sprintf("<td>%s</td>", html.EscapeString(fmt.Sprint(v)))
+		}
+		content += "</tr>\n" + renderHTMLTreeRows(n.Children, depth+1)
+	}
+	return content
+}
+
+// Renders a single item as HTML
+func renderHTMLItem(item Item) string {
+	esc := html.EscapeString
+
+	switch i := item.(type) {
+	case Text:
+		return fmt.Sprintf("<p>%s</p>\n", esc(i.Line))
+	case Count:
+		return fmt.Sprintf("<p><b>%d</b> %s</p>\n", i.Value, esc(i.Label))
+	case Property:
+		value := esc(i.Value)
+		if value == "" {
+			value = `<span class="missing">(not found)</span>`
+		}
+		return fmt.Sprintf("<p>%s: %s</p>\n", esc(i.Name), value)
+	case List:
+		content := ""
+		if i.Title != "" {
+			content = fmt.Sprintf("<p>%s:</p>\n", esc(i.Title))
+		}
+		content += "<ul>\n"
+		for _, e := range i.Entries {
+			content += fmt.Sprintf("<li>%s</li>\n", esc(e))
+		}
+		return content + "</ul>\n"
+	case Table:
+		content := ""
+		if i.Title != "" {
+			content = fmt.Sprintf("<p>%s:</p>\n", esc(i.Title))
+		}
+		content += "<table class=\"sortable\">\n<tr>"
+		for _, c := range i.Columns {
+			content += fmt.Sprintf("<th>%s</th>", esc(c))
+		}
+		content += "</tr>\n"
+		for _, r := range i.Rows {
+			cells := make([]string, len(r))
+			for j, v := range r {
+				cells[j] = fmt.Sprintf("<td>%s</td>", esc(fmt.Sprint(v)))
+			}
+			content += "<tr>" + strings.Join(cells, "") + "</tr>\n"
+		}
+		return content + "</table>\n"
+	case Tree:
+		content := ""
+		if i.Title != "" {
+			content = fmt.Sprintf("<p>%s:</p>\n", esc(i.Title))
+		}
+		if len(i.Columns) == 0 {
+			return content + renderHTMLTree(i.Nodes)
+		}
+
+		// Trees with columns are rendered as table, which is not sortable to keep the order of the tree
+		content += "<table>\n<tr>"
+		for _, c := range i.Columns {
+			content += fmt.Sprintf("<th>%s</th>", esc(c))
+		}
+		content += "</tr>\n"
+		return content + renderHTMLTreeRows(i.Nodes, 0) + "</table>\n"
+	case Finding:
+		source := ""
+		if i.Source != "" {
+			source = fmt.Sprintf(" <small>(in %s)</small>", esc(i.Source))
+		}
+		return fmt.Sprintf("<p class=\"finding %s\">[%s] %s%s</p>\n", esc(string(i.Severity)), esc(string(i.Severity)), esc(i.Message), source)
+	}
+
+	// Unknown item type, should never happen
+	return fmt.Sprintf("<p>(unable to render %s)</p>\n", esc(item.Kind()))
+}
@@ -0,0 +1,62 @@
+package output
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// Report is the complete result of a pancap run
+type Report struct {
+	Capture Capture `json:"capture"`
+	Blocks  []Block `json:"blocks"`
+	Files   []*File `json:"-"`
+	Graph   *Graph  `json:"-"`
+}
+
+// Capture describes the analyzed capture files
+type Capture struct {
+	Files      []string `json:"files"`
+	LinkType   string   `json:"linkType"`
+	LinkTypeID int      `json:"linkTypeID"`
+}
+
+// MarshalJSON encodes the block, adding the kind of every item to the item itself
+func (b Block) MarshalJSON() ([]byte, error) {
+	items := make([]json.RawMessage, 0, len(b.Items))
+	for _, i := range b.Items {
+		raw, marshalErr := json.Marshal(i)
+		if marshalErr != nil {
+			return nil, marshalErr
+		}
+		kind, _ := json.Marshal(i.Kind())
+
+		// Splice the kind into the encoded object, which always starts with '{'
+		tagged := append([]byte(`{"kind":`), kind...)
+		if len(raw) > 2 {
+			tagged = append(tagged, ',')
+		}
+		items = append(items, append(tagged, raw[1:]...))
+	}
+
+	return json.Marshal(struct {
+		Headline string            `json:"headline"`
+		Span     *Span             `json:"span,omitempty"`
+		Items    []json.RawMessage `json:"items"`
+	}{b.Headline, b.Span, items})
+}
+
+// Writes the given report as JSON document, either to stdout (if filename is "-") or to the given file
+func writeJSON(report Report, filename string) error {
+	document, marshalErr := json.MarshalIndent(report, "", "\t")
+	if marshalErr != nil {
+		return marshalErr
+	}
+	document = append(document, '\n')
+
+	if filename == "-" {
+		_, writeErr := os.Stdout.Write(document)
+		return writeErr
+	}
+	return ioutil.WriteFile(filename, document, 0644)
+}
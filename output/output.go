@@ -3,7 +3,12 @@ package output
 import "github.com/fatih/color"
 
 // Called at the very end, before terminating pancap
-func Finalize() {
+func Finalize(report Report) {
+	// Hints are meant for humans - avoid breaking machine-readable output
+	if !TextMode() {
+		return
+	}
+
 	printer := color.New(color.Bold, color.BgBlack)
 
 	// Check if we snipped, to add a notice how to show the whole block
@@ -18,14 +23,30 @@ func Finalize() {
 		printer.Println("Some submodule output was hidden. Add --print-empty-blocks to show it.")
 	}
 
+	// Check if modules encountered errors, which are only counted by default
+	if !fullOutput {
+		for _, b := range report.Blocks {
+			if b.Headline == ErrorsHeadline {
+				printer.Println("Modules encountered errors. Add --full-output to see examples, or --verbose-errors to log each of them.")
+				break
+			}
+		}
+	}
+
 	// Check if the user didn't use the file extract option, although there were files available to extract
-	if extractedFiles == 0 && len(registeredFiles) > 0 {
+	extractedFiles := 0
+	for _, f := range report.Files {
+		if f.path != "" {
+			extractedFiles++
+		}
+	}
+	if extractedFiles == 0 && len(report.Files) > 0 {
 		// User avoided the files
 		printer.Println("Files found in stream. Add --extract-all or --extract-these <list> to extract them.")
 	}
 
 	// Check if something graph-worthy was collected
-	if graphOutput == "" && len(graphPkgs) > 0 {
+	if graphOutput == "" && report.Graph != nil && !report.Graph.IsEmpty() {
 		// User didn't want a graph
 		printer.Println("To summarize the communcation flow with a Graphviz graph, specify --create-graph <out.dot>.")
 	}
@@ -1,10 +1,14 @@
 package output
 
 import (
+	"bytes"
 	"fmt"
+	"log"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/fatih/color"
+	"github.com/maride/pancap/common"
 )
 
 const (
@@ -17,6 +21,153 @@ var (
 	DidAvoidEmptyBlock bool
 )
 
+// Prints the report in the requested format, and writes it to the requested JSON file
+func PrintReport(report Report) {
+	if TextMode() {
+		PrintBlocks(report.Blocks)
+	} else {
+		// Print report as JSON document to stdout
+		if writeErr := writeJSON(report, "-"); writeErr != nil {
+			log.Printf("Unable to print JSON report: %s", writeErr.Error())
+		}
+	}
+
+	// Check if we should write the JSON document to a file, too
+	if jsonOutput != "" {
+		if writeErr := writeJSON(report, jsonOutput); writeErr != nil {
+			log.Printf("Unable to write JSON report to %s: %s", jsonOutput, writeErr.Error())
+		}
+	}
+
+	// Check if we should write a Graphviz graph
+	if graphOutput != "" && report.Graph != nil {
+		if writeErr := report.Graph.CreateGraph(graphOutput); writeErr != nil {
+			log.Printf("Unable to write graph to %s: %s", graphOutput, writeErr.Error())
+		}
+	}
+
+	// Check if we should write a HTML report
+	if htmlOutput != "" {
+		if writeErr := writeHTML(report, htmlOutput); writeErr != nil {
+			log.Printf("Unable to write HTML report to %s: %s", htmlOutput, writeErr.Error())
+		}
+	}
+}
+
+// Prints all given blocks
+func PrintBlocks(blocks []Block) {
+	for _, b := range blocks {
+		content := RenderBlock(b)
+
+		// State the time span the block covers, if it isn't empty anyway
+		if b.Span != nil && content != "" {
+			content = color.New(color.Faint).Sprintf("Covering %s", b.Span) + "\n" + content
+		}
+
+		PrintBlock(b.Headline, content)
+	}
+}
+
+// Renders the items of the given block as human-readable text
+func RenderBlock(b Block) string {
+	content := ""
+	for _, i := range b.Items {
+		content += renderItem(i)
+	}
+	return content
+}
+
+// Renders a single item as human-readable text, including the trailing newline
+func renderItem(item Item) string {
+	switch i := item.(type) {
+	case Text:
+		return i.Line + "\n"
+	case Count:
+		return fmt.Sprintf("%d %s\n", i.Value, i.Label)
+	case Property:
+		value := i.Value
+		if value == "" {
+			// No value found, mark it in red
+			value = color.New(color.FgRed).Sprint("(not found)")
+		}
+		return fmt.Sprintf("%s: %s\n", i.Name, value)
+	case List:
+		if len(i.Entries) == 0 {
+			return ""
+		}
+		tree := common.GenerateTree(i.Entries)
+		if i.Title != "" {
+			tree = i.Title + ":\n" + tree
+		}
+		return tree
+	case Table:
+		return renderTable(i)
+	case Tree:
+		return renderTree(i)
+	case Finding:
+		marker := color.New(color.FgYellow, color.Bold)
+		if i.Source != "" {
+			return fmt.Sprintf("%s %s (in %s)\n", marker.Sprintf("[%s]", i.Severity), i.Message, i.Source)
+		}
+		return fmt.Sprintf("%s %s\n", marker.Sprintf("[%s]", i.Severity), i.Message)
+	}
+
+	// Unknown item type, should never happen
+	return fmt.Sprintf("(unable to render %s)\n", item.Kind())
+}
+
+// Renders the given table with aligned columns, rows drawn as a tree
+func renderTable(t Table) string {
+	if len(t.Rows) == 0 {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  %s\n", strings.Join(t.Columns, "\t"))
+	for _, r := range t.Rows {
+		values := make([]string, len(r))
+		for i, v := range r {
+			values[i] = fmt.Sprint(v)
+		}
+		fmt.Fprintf(w, "  %s\n", strings.Join(values, "\t"))
+	}
+	w.Flush()
+
+	// Replace the indentation of the rows with the tree characters
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i := range lines[1:] {
+		lines[i+1] = strings.TrimPrefix(lines[i+1], "  ")
+	}
+	content := lines[0] + "\n" + common.GenerateTree(lines[1:])
+	if t.Title != "" {
+		content = t.Title + ":\n" + content
+	}
+	return content
+}
+
+// Renders the given tree, with the values of the nodes in aligned columns next to it
+func renderTree(t Tree) string {
+	content := common.GenerateNestedTree(t.Nodes)
+	if len(t.Columns) > 0 {
+		var buf bytes.Buffer
+		w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "  %s\n", strings.Join(t.Columns, "\t"))
+		common.WalkNestedTree(t.Nodes, func(line string, node common.TreeNode) {
+			for _, v := range node.Values {
+				line += "\t" + fmt.Sprint(v)
+			}
+			fmt.Fprintf(w, "%s\n", line)
+		})
+		w.Flush()
+		content = buf.String()
+	}
+	if t.Title != "" {
+		content = t.Title + ":\n" + content
+	}
+	return content
+}
+
 // Prints a block of information with the given headline
 // If content is empty, printing the headline is omitted.
 // If the content is longer than MaxContentLines, content is cut.
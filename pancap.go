@@ -0,0 +1,121 @@
+// Package pancap analyzes capture files and summarizes the information found in them.
+//
+// All state is kept per Analyzer, so several captures can be analyzed in one process, even at the same time:
+//
+//	source, _, file, err := capture.Open("capture.pcapng")
+//	report, err := pancap.NewAnalyzer(pancap.Options{}).Run(source)
+//	file.Close()
+package pancap
+
+import (
+	"github.com/google/gopacket"
+	"github.com/maride/pancap/analyze"
+	"github.com/maride/pancap/analyze/flow"
+	"github.com/maride/pancap/analyze/stream"
+	"github.com/maride/pancap/filter"
+	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/progress"
+	"github.com/maride/pancap/protocol"
+)
+
+// Report is the result of an analysis, ready to be printed or processed further
+type Report = output.Report
+
+// Options configures an Analyzer
+type Options struct {
+	// Extract all found files to ExtractTo
+	ExtractAll bool
+	// Hashes of the found files to extract to ExtractTo
+	ExtractFiles []string
+	// Directory to store extracted files in, defaults to "./extracted"
+	ExtractTo string
+	// Directory to write every TCP connection and UDP pseudo-stream to, as client, server and combined files. If empty, nothing is written.
+	DumpStreams string
+	// Names of the modules to run. If empty, all modules enabled by default are run.
+	Modules []string
+	// Names of the modules not to run
+	SkipModules []string
+	// Amount of entries shown in top lists, e.g. of hosts. Defaults to 10.
+	Top int
+	// Options of the modules by "<module>.<name>", e.g. "usbkeyboard.layout". Options not given keep their default.
+	ModuleOptions map[string]string
+	// Only packets matching this filter are analyzed, see filter.New. If nil, all packets are analyzed.
+	Filter *filter.Filter
+	// Only packets captured in this time window are analyzed, see filter.NewWindow. If nil, all packets are analyzed.
+	Window *filter.Window
+	// Reports the progress of the analysis, see progress.New. If nil, progress isn't reported.
+	Progress *progress.Reporter
+	// Log every error encountered by a module, instead of only counting them
+	VerboseErrors bool
+	// List a few examples for each kind of error in the report
+	ErrorExamples bool
+}
+
+// Analyzer runs all protocol modules over a capture
+type Analyzer struct {
+	options Options
+}
+
+// Creates a new analyzer with the given options
+func NewAnalyzer(options Options) *Analyzer {
+	if options.ExtractTo == "" {
+		options.ExtractTo = "./extracted"
+	}
+	if options.Top <= 0 {
+		options.Top = 10
+	}
+
+	return &Analyzer{
+		options: options,
+	}
+}
+
+// Run analyzes all packets of the given source and returns the report.
+// Every call starts with a fresh set of modules, so an analyzer may be used for several sources.
+func (a *Analyzer) Run(source *gopacket.PacketSource) (*Report, error) {
+	// Select modules to run
+	modules, selectErr := protocol.Select(a.options.Modules, a.options.SkipModules)
+	if selectErr != nil {
+		return nil, selectErr
+	}
+
+	// Check the options handed over to the modules
+	if optionsErr := protocol.CheckOptions(a.options.ModuleOptions); optionsErr != nil {
+		return nil, optionsErr
+	}
+
+	files := output.NewFileManager()
+	graph := output.NewGraph()
+	flows := flow.NewTable()
+	ctx := &protocol.Context{
+		Files:   files,
+		Flows:   flows,
+		Streams: stream.NewService(flows, a.options.DumpStreams),
+		Top:     a.options.Top,
+		Options: a.options.ModuleOptions,
+	}
+	analyzer := analyze.New(ctx, modules, graph, analyze.Options{
+		Filter:        a.options.Filter,
+		Window:        a.options.Window,
+		Progress:      a.options.Progress,
+		VerboseErrors: a.options.VerboseErrors,
+		ErrorExamples: a.options.ErrorExamples,
+	})
+
+	// Start analyzing
+	analyzeErr := analyzer.Analyze(source)
+	if analyzeErr != nil {
+		return nil, analyzeErr
+	}
+
+	// Extract found and requested files
+	if a.options.ExtractAll || len(a.options.ExtractFiles) > 0 {
+		files.StoreFiles(a.options.ExtractAll, a.options.ExtractFiles, a.options.ExtractTo)
+	}
+
+	return &Report{
+		Blocks: append(analyzer.Summary(), files.Summary()),
+		Files:  files.Files(),
+		Graph:  graph,
+	}, nil
+}
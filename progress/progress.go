@@ -0,0 +1,194 @@
+// Package progress reports the progress of an analysis while it is running.
+//
+// Progress is either shown as a single, continuously updated line for humans,
+// or as one JSON object per line for programs wrapping pancap.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/maride/pancap/capture"
+	"github.com/mattn/go-isatty"
+)
+
+// Interval in which the progress is reported
+const interval = 500 * time.Millisecond
+
+// Mode selects how the progress is reported
+type Mode string
+
+const (
+	// Report as text if the output is a terminal, otherwise don't report at all
+	ModeAuto Mode = "auto"
+	ModeText Mode = "text"
+	ModeJSON Mode = "json"
+	ModeOff  Mode = "off"
+)
+
+// ParseMode returns the mode with the given name
+func ParseMode(name string) (Mode, error) {
+	switch m := Mode(name); m {
+	case ModeAuto, ModeText, ModeJSON, ModeOff:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown progress mode '%s', expected auto, text, json or off", name)
+}
+
+// Reporter periodically reports the amount of packets and bytes read
+type Reporter struct {
+	mode    Mode
+	out     io.Writer
+	counter *capture.ReadCounter
+
+	packets int64
+	started time.Time
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// State is the progress at a single point in time, as reported in JSON mode
+type State struct {
+	Packets          int64   `json:"packets"`
+	PacketsPerSecond float64 `json:"packetsPerSecond"`
+	BytesRead        int64   `json:"bytesRead"`
+	BytesTotal       int64   `json:"bytesTotal,omitempty"`
+	Percent          float64 `json:"percent,omitempty"`
+	ETASeconds       float64 `json:"etaSeconds,omitempty"`
+	Done             bool    `json:"done"`
+}
+
+// Creates a new reporter writing to out in the given mode, using counter (if not nil) to tell how much of the capture was read.
+// Returns nil if there is nothing to report, i.e. mode is ModeOff or ModeAuto and out is not a terminal.
+func New(mode Mode, out *os.File, counter *capture.ReadCounter) *Reporter {
+	if mode == ModeAuto {
+		mode = ModeOff
+		if isatty.IsTerminal(out.Fd()) || isatty.IsCygwinTerminal(out.Fd()) {
+			mode = ModeText
+		}
+	}
+	if mode == ModeOff {
+		return nil
+	}
+
+	return &Reporter{
+		mode:    mode,
+		out:     out,
+		counter: counter,
+	}
+}
+
+// Start starts reporting periodically, until Stop is called
+func (r *Reporter) Start() {
+	if r == nil {
+		return
+	}
+
+	r.started = time.Now()
+	r.stop = make(chan struct{})
+	r.stopped.Add(1)
+	go func() {
+		defer r.stopped.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.report(false)
+			case <-r.stop:
+				r.report(true)
+				return
+			}
+		}
+	}()
+}
+
+// Packet counts a single packet read. It is safe to call concurrently with the reporting.
+func (r *Reporter) Packet() {
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.packets, 1)
+}
+
+// Stop stops reporting, after reporting the final state
+func (r *Reporter) Stop() {
+	if r == nil || r.stop == nil {
+		return
+	}
+	close(r.stop)
+	r.stopped.Wait()
+}
+
+// Returns the current progress
+func (r *Reporter) state(done bool) State {
+	s := State{
+		Packets: atomic.LoadInt64(&r.packets),
+		Done:    done,
+	}
+
+	elapsed := time.Since(r.started).Seconds()
+	if elapsed > 0 {
+		s.PacketsPerSecond = float64(s.Packets) / elapsed
+	}
+
+	if r.counter != nil {
+		s.BytesRead = r.counter.BytesRead()
+		s.BytesTotal = r.counter.Size()
+
+		// Estimate the time left, assuming the bytes are read at a constant rate
+		if s.BytesTotal > 0 && s.BytesRead > 0 {
+			s.Percent = float64(s.BytesRead) * 100 / float64(s.BytesTotal)
+			if !done {
+				s.ETASeconds = elapsed * float64(s.BytesTotal-s.BytesRead) / float64(s.BytesRead)
+			}
+		}
+	}
+
+	return s
+}
+
+// Writes the current progress
+func (r *Reporter) report(done bool) {
+	s := r.state(done)
+
+	if r.mode == ModeJSON {
+		line, _ := json.Marshal(s)
+		fmt.Fprintf(r.out, "%s\n", line)
+		return
+	}
+
+	// Overwrite the previous line, and keep the last one when done
+	line := fmt.Sprintf("%d packets, %.0f packets/s, %s", s.Packets, s.PacketsPerSecond, formatBytes(s.BytesRead))
+	if s.BytesTotal > 0 {
+		line += fmt.Sprintf(" of %s (%.0f%%)", formatBytes(s.BytesTotal), s.Percent)
+	}
+	if !done && s.ETASeconds > 0 {
+		line += fmt.Sprintf(", ETA %s", time.Duration(s.ETASeconds*float64(time.Second)).Round(time.Second))
+	}
+	fmt.Fprintf(r.out, "\r\033[K%s", line)
+	if done {
+		fmt.Fprint(r.out, "\n")
+	}
+}
+
+// Formats the given amount of bytes with a binary prefix, e.g. "1.5 GiB"
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
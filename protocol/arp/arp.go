@@ -4,22 +4,39 @@ import (
 	"fmt"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/capture"
 	"github.com/maride/pancap/common"
 	"github.com/maride/pancap/output"
-	"log"
+	"github.com/maride/pancap/protocol"
 	"net"
 )
 
 var (
-	arpStatsList   []arpStats
-	devices        []arpDevice
 	linkLocalBlock = net.IPNet{
 		IP:   net.IPv4(169, 254, 0, 0),
 		Mask: net.IPv4Mask(255, 255, 0, 0),
 	}
 )
 
-type Protocol struct{}
+type Protocol struct {
+	arpStatsList []arpStats
+	devices      []arpDevice
+	spoofings    []output.Finding
+
+	// File the packet currently analyzed comes from, if several files are analyzed
+	origin string
+}
+
+func init() {
+	protocol.Register(protocol.Module{
+		Name:        "arp",
+		Description: "Collects ARP communication, identifies devices and detects ARP spoofing",
+		Enabled:     true,
+		New: func(ctx *protocol.Context) protocol.Protocol {
+			return &Protocol{}
+		},
+	})
+}
 
 // Checks if the given packet is an ARP packet we can process
 func (p *Protocol) CanAnalyze(packet gopacket.Packet) bool {
@@ -37,6 +54,9 @@ func (p *Protocol) Analyze(packet gopacket.Packet) error {
 		return decodeErr
 	}
 
+	// Remember where this packet comes from, for findings
+	p.origin = capture.Origin(packet)
+
 	// Convert MAC address byte array to string
 	sourceAddr := net.HardwareAddr(arppacket.SourceHwAddress).String()
 	participant := p.getStatOrCreate(sourceAddr)
@@ -61,68 +81,77 @@ func (p *Protocol) Analyze(packet gopacket.Packet) error {
 	return nil
 }
 
-// Print a summary after all packets are processed
-func (p *Protocol) PrintSummary() {
-	output.PrintBlock("ARP traffic summary", p.generateTrafficStats())
-	output.PrintBlock("ARP LAN overview", p.generateLANOverview())
+// Returns the summary after all packets are processed
+func (p *Protocol) Summary() []output.Block {
+	return []output.Block{
+		p.generateTrafficStats(),
+		p.generateLANOverview(),
+	}
 }
 
 // Generates an answer regarding the ARP traffic
-func (p *Protocol) generateTrafficStats() string {
+func (p *Protocol) generateTrafficStats() output.Block {
 	var tmparr []string
 
 	// Iterate over all participants
-	for _, p := range arpStatsList {
+	for _, stat := range p.arpStatsList {
 		// produce a meaningful output
-		if p.asked > 0 {
+		if stat.asked > 0 {
 			// device asked at least for one IP
-			if p.answered > 0 {
+			if stat.answered > 0 {
 				// and also answered requests
-				tmparr = append(tmparr, fmt.Sprintf("%s asked for %d addresses and answered %d requests", p.macaddr, p.asked, p.answered))
+				tmparr = append(tmparr, fmt.Sprintf("%s asked for %d addresses and answered %d requests", stat.macaddr, stat.asked, stat.answered))
 			} else {
 				// only asked, never answered
-				tmparr = append(tmparr, fmt.Sprintf("%s asked for %d addresses", p.macaddr, p.asked))
+				tmparr = append(tmparr, fmt.Sprintf("%s asked for %d addresses", stat.macaddr, stat.asked))
 			}
 		} else {
 			// Answered, but never asked for any addresses
-			tmparr = append(tmparr, fmt.Sprintf("%s answered %d requests", p.macaddr, p.answered))
+			tmparr = append(tmparr, fmt.Sprintf("%s answered %d requests", stat.macaddr, stat.answered))
 		}
 	}
 
-	// And print it as a tree
-	return common.GenerateTree(tmparr)
+	// And return it as a list
+	block := output.Block{Headline: "ARP traffic summary"}
+	block.Add(output.List{Entries: tmparr})
+	return block
 }
 
 // Generates an overview over all connected devices in the LAN
-func (p *Protocol) generateLANOverview() string {
+func (p *Protocol) generateLANOverview() output.Block {
 	var tmparr []string
 
 	// iterate over all devices
-	for _, d := range devices {
+	for _, d := range p.devices {
 		tmparr = append(tmparr, fmt.Sprintf("%s got address %s", d.macaddr, d.ipaddr))
 	}
 
-	// And print it as a tree
-	return common.GenerateTree(tmparr)
+	// And return it as a list, along with possible spoofing attempts
+	block := output.Block{Headline: "ARP LAN overview"}
+	block.Add(output.List{Entries: tmparr})
+	for _, f := range p.spoofings {
+		block.Add(f)
+	}
+	return block
 }
 
 // Returns the arpStats object for the given MAC address, or creates a new one
 func (p *Protocol) getStatOrCreate(macaddr string) *arpStats {
 	// Try to find the given macaddr
-	for i := 0; i < len(arpStatsList); i++ {
-		if arpStatsList[i].macaddr == macaddr {
+	for i := 0; i < len(p.arpStatsList); i++ {
+		if p.arpStatsList[i].macaddr == macaddr {
 			// Found, return it
-			return &arpStatsList[i]
+			return &p.arpStatsList[i]
 		}
 	}
 
 	// None found yet, we need to create a new one
-	arpStatsList = append(arpStatsList, arpStats{
+	p.arpStatsList = append(p.arpStatsList, arpStats{
 		macaddr: macaddr,
 	})
 
 	// And return it
-	return &arpStatsList[len(arpStatsList)-1]
+	return &p.arpStatsList[len(p.arpStatsList)-1]
 }
 
 // Adds a new entry to the devices array, checking if there may be a collision (=ARP Spoofing)
@@ -132,30 +161,34 @@ func (p *Protocol) addDeviceEntry(macaddr string, ipaddr string) {
 		return
 	}
 
-	for i := 0; i < len(devices); i++ {
+	for i := 0; i < len(p.devices); i++ {
 		// check if we found a collision (possible ARP spoofing)
-		if (devices[i].macaddr == macaddr) != (devices[i].ipaddr == ipaddr) {
+		if (p.devices[i].macaddr == macaddr) != (p.devices[i].ipaddr == ipaddr) {
 			// this operation is practically XOR (which golang doesn't provide e.g. with ^)
 
 			// Check if one address is in the link-local block (169.254.0.0/16), ignore "ARP spoofing" then
-			if !linkLocalBlock.Contains(net.ParseIP(devices[i].ipaddr)) && !linkLocalBlock.Contains(net.ParseIP(ipaddr)) {
+			if !linkLocalBlock.Contains(net.ParseIP(p.devices[i].ipaddr)) && !linkLocalBlock.Contains(net.ParseIP(ipaddr)) {
 				// The old and the new IP are both outside of the link-local range - we can warn about ARP spoofing
-				log.Printf("Found possible ARP spoofing! Old: (MAC=%s, IP=%s), New: (MAC=%s, IP=%s). Overriding...", devices[i].macaddr, devices[i].ipaddr, macaddr, ipaddr)
+				p.spoofings = append(p.spoofings, output.Finding{
+					Severity: output.SeverityWarning,
+					Message:  fmt.Sprintf("Found possible ARP spoofing! Old: (MAC=%s, IP=%s), New: (MAC=%s, IP=%s)", p.devices[i].macaddr, p.devices[i].ipaddr, macaddr, ipaddr),
+					Source:   p.origin,
+				})
 			}
 
-			devices[i].macaddr = macaddr
-			devices[i].ipaddr = ipaddr
+			p.devices[i].macaddr = macaddr
+			p.devices[i].ipaddr = ipaddr
 			return
 		}
 
-		if devices[i].macaddr == macaddr && devices[i].ipaddr == ipaddr {
+		if p.devices[i].macaddr == macaddr && p.devices[i].ipaddr == ipaddr {
 			// Found collision, but no ARP spoofing (both values are identical)
 			return
 		}
 	}
 
 	// No device found, add a new entry
-	devices = append(devices, arpDevice{
+	p.devices = append(p.devices, arpDevice{
 		macaddr: macaddr,
 		ipaddr:  ipaddr,
 	})
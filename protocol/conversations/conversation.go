@@ -0,0 +1,114 @@
+package conversations
+
+import (
+	"time"
+
+	"github.com/maride/pancap/analyze/flow"
+)
+
+// Identifies a conversation in both directions, with the lower address always stored as a
+type conversationKey struct {
+	protocol string
+	a        string
+	b        string
+}
+
+// Packets and bytes sent in one direction, or by one host
+type counter struct {
+	packets int
+	bytes   int
+}
+
+// A conversation between two endpoints
+type conversation struct {
+	key   conversationKey
+	aToB  counter
+	bToA  counter
+	start time.Time
+	end   time.Time
+	// Annotations of the underlying flows
+	notes []string
+}
+
+// A single host, along with the traffic it sent and received
+type host struct {
+	address  string
+	sent     counter
+	received counter
+}
+
+// Creates the key of the conversation between the given endpoints, regardless of their order
+func newConversationKey(protocol string, src string, dst string) conversationKey {
+	if dst < src {
+		src, dst = dst, src
+	}
+	return conversationKey{protocol: protocol, a: src, b: dst}
+}
+
+// Checks if the key sorts before the other key
+func (k conversationKey) less(other conversationKey) bool {
+	if k.protocol != other.protocol {
+		return k.protocol < other.protocol
+	}
+	if k.a != other.a {
+		return k.a < other.a
+	}
+	return k.b < other.b
+}
+
+// Adds the packets of a flow to the conversation with the given key, with src being the client of the flow
+func addFlow(conversations map[conversationKey]*conversation, key conversationKey, src string, stats flow.Stats, notes []string) {
+	c, ok := conversations[key]
+	if !ok {
+		c = &conversation{key: key, start: stats.Start, end: stats.End}
+		conversations[key] = c
+	}
+
+	if src == key.a {
+		c.aToB.addCounter(stats.ClientToServer)
+		c.bToA.addCounter(stats.ServerToClient)
+	} else {
+		c.aToB.addCounter(stats.ServerToClient)
+		c.bToA.addCounter(stats.ClientToServer)
+	}
+	c.notes = append(c.notes, notes...)
+
+	if stats.Start.Before(c.start) {
+		c.start = stats.Start
+	}
+	if stats.End.After(c.end) {
+		c.end = stats.End
+	}
+}
+
+// Returns the host with the given address, creating it if necessary
+func getHost(hosts map[string]*host, address string) *host {
+	h, ok := hosts[address]
+	if !ok {
+		h = &host{address: address}
+		hosts[address] = h
+	}
+	return h
+}
+
+// Adds the packets and bytes of a flow direction
+func (c *counter) addCounter(other flow.Counter) {
+	c.packets += other.Packets
+	c.bytes += other.Bytes
+}
+
+// Adds the traffic of a flow the host took part in
+func (h *host) add(sent flow.Counter, received flow.Counter) {
+	h.sent.addCounter(sent)
+	h.received.addCounter(received)
+}
+
+// Returns the bytes sent in both directions
+func (c *conversation) bytes() int {
+	return c.aToB.bytes + c.bToA.bytes
+}
+
+// Returns the bytes sent and received
+func (h *host) bytes() int {
+	return h.sent.bytes + h.received.bytes
+}
@@ -0,0 +1,157 @@
+package conversations
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/analyze/flow"
+	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/protocol"
+)
+
+type Protocol struct {
+	// Amount of conversations and hosts shown
+	top int
+
+	flows *flow.Table
+}
+
+func init() {
+	protocol.Register(protocol.Module{
+		Name:        "conversations",
+		Description: "Tracks IP and TCP/UDP conversations and the top talkers by bytes",
+		Enabled:     true,
+		New: func(ctx *protocol.Context) protocol.Protocol {
+			return New(ctx.Flows, ctx.Top)
+		},
+	})
+}
+
+// Creates a new conversations module based on the given flow table, showing the top conversations and hosts
+func New(flows *flow.Table, top int) *Protocol {
+	return &Protocol{
+		top:   top,
+		flows: flows,
+	}
+}
+
+// Conversations are read from the flow table, so the module doesn't need any packets
+func (p *Protocol) CanAnalyze(packet gopacket.Packet) bool {
+	return false
+}
+
+// Never called, as the module doesn't analyze any packets
+func (p *Protocol) Analyze(packet gopacket.Packet) error {
+	return nil
+}
+
+// Prints the top conversations and hosts
+func (p *Protocol) Summary() []output.Block {
+	ipConversations := make(map[conversationKey]*conversation)
+	transportConversations := make(map[conversationKey]*conversation)
+	hosts := make(map[string]*host)
+	var span output.Span
+
+	// Aggregate all flows into conversations between hosts, TCP and UDP conversations and hosts
+	for _, f := range p.flows.Flows() {
+		stats := f.Stats()
+		span.Extend(stats.Start)
+		span.Extend(stats.End)
+
+		addFlow(ipConversations, newConversationKey("IP", f.Client.Address, f.Server.Address), f.Client.Address, stats, nil)
+		if f.Key.Protocol == layers.IPProtocolTCP || f.Key.Protocol == layers.IPProtocolUDP {
+			addFlow(transportConversations, newConversationKey(f.Key.Protocol.String(), f.Client.String(), f.Server.String()), f.Client.String(), stats, f.Annotations())
+		}
+
+		getHost(hosts, f.Client.Address).add(stats.ClientToServer, stats.ServerToClient)
+		getHost(hosts, f.Server.Address).add(stats.ServerToClient, stats.ClientToServer)
+	}
+
+	blocks := []output.Block{
+		p.conversationSummary("IP conversations", ipConversations, false),
+		p.conversationSummary("TCP/UDP conversations", transportConversations, true),
+		p.hostSummary(hosts),
+	}
+	if !span.IsEmpty() {
+		for i := range blocks {
+			blocks[i].Span = &span
+		}
+	}
+	return blocks
+}
+
+// Returns the top conversations of the given map, by bytes
+func (p *Protocol) conversationSummary(headline string, conversations map[conversationKey]*conversation, withProtocol bool) output.Block {
+	sorted := make([]*conversation, 0, len(conversations))
+	for _, c := range conversations {
+		sorted = append(sorted, c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].bytes() != sorted[j].bytes() {
+			return sorted[i].bytes() > sorted[j].bytes()
+		}
+		return sorted[i].key.less(sorted[j].key)
+	})
+
+	table := output.Table{
+		Columns: []string{"Address A", "Address B", "Packets A→B", "Bytes A→B", "Packets B→A", "Bytes B→A", "Start", "Duration"},
+	}
+	if withProtocol {
+		table.Columns = append(append([]string{"Protocol"}, table.Columns...), "Notes")
+	}
+	for i, c := range sorted {
+		if i == p.top {
+			break
+		}
+		row := []interface{}{c.key.a, c.key.b, c.aToB.packets, c.aToB.bytes, c.bToA.packets, c.bToA.bytes, c.start.Format("2006-01-02 15:04:05"), c.end.Sub(c.start).Round(time.Millisecond).String()}
+		if withProtocol {
+			row = append(append([]interface{}{c.key.protocol}, row...), strings.Join(c.notes, ", "))
+		}
+		table.AddRow(row...)
+	}
+
+	block := output.Block{Headline: headline}
+	block.Add(
+		output.Count{Name: "conversations", Value: len(conversations), Label: "conversations in total"},
+		table,
+	)
+	if len(sorted) > p.top {
+		block.Add(output.Text{Line: fmt.Sprintf("Showing the top %d of %d conversations by bytes.", p.top, len(sorted))})
+	}
+	return block
+}
+
+// Returns the top hosts, by bytes sent and received
+func (p *Protocol) hostSummary(hosts map[string]*host) output.Block {
+	sorted := make([]*host, 0, len(hosts))
+	for _, h := range hosts {
+		sorted = append(sorted, h)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].bytes() != sorted[j].bytes() {
+			return sorted[i].bytes() > sorted[j].bytes()
+		}
+		return sorted[i].address < sorted[j].address
+	})
+
+	table := output.Table{
+		Columns: []string{"Host", "Packets sent", "Bytes sent", "Packets received", "Bytes received", "Bytes"},
+	}
+	for i, h := range sorted {
+		if i == p.top {
+			break
+		}
+		table.AddRow(h.address, h.sent.packets, h.sent.bytes, h.received.packets, h.received.bytes, h.bytes())
+	}
+
+	block := output.Block{Headline: "Top talkers"}
+	block.Add(table)
+	if len(sorted) > p.top {
+		block.Add(output.Text{Line: fmt.Sprintf("Showing the top %d of %d hosts by bytes.", p.top, len(sorted))})
+	}
+	return block
+}
@@ -1,16 +1,37 @@
 package dhcpv4
 
 import (
+	"fmt"
+
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/capture"
 	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/protocol"
 )
 
 type Protocol struct {
-	hostnames    []hostname
-	networkSetup map[layers.DHCPOpt][]byte
-	requestMAC   []string
-	responses    []dhcpResponse
+	hostnames        []hostname
+	networkSetup     map[layers.DHCPOpt][]byte
+	requestMAC       []string
+	responses        []dhcpResponse
+	networkFindings  []output.Finding
+	responseFindings []output.Finding
+	hostnameFindings []output.Finding
+
+	// File the packet currently analyzed comes from, if several files are analyzed
+	origin string
+}
+
+func init() {
+	protocol.Register(protocol.Module{
+		Name:        "dhcpv4",
+		Description: "Analyzes DHCP requests and responses to get an idea of the network setup",
+		Enabled:     true,
+		New: func(ctx *protocol.Context) protocol.Protocol {
+			return &Protocol{}
+		},
+	})
 }
 
 // Checks if the given packet is a DHCP packet we can process
@@ -49,6 +70,9 @@ func (p *Protocol) Analyze(packet gopacket.Packet) error {
 		return decodeEthernetErr
 	}
 
+	// Remember where this packet comes from, for findings
+	p.origin = capture.Origin(packet)
+
 	// Examine packet further
 	if dhcppacket.Operation == layers.DHCPOpRequest {
 		// Request packet
@@ -65,10 +89,21 @@ func (p *Protocol) Analyze(packet gopacket.Packet) error {
 	return nil
 }
 
-// Print summary after all packets are processed
-func (p *Protocol) PrintSummary() {
-	output.PrintBlock("DHCP Network Overview", p.generateNetworkSummary())
-	output.PrintBlock("DHCP Requests", p.generateRequestSummary())
-	output.PrintBlock("DHCP Responses/Offers", p.generateResponseSummary())
-	output.PrintBlock("DHCP Hostnames", p.generateHostnamesSummary())
+// Returns the summary after all packets are processed
+func (p *Protocol) Summary() []output.Block {
+	return []output.Block{
+		p.generateNetworkSummary(),
+		p.generateRequestSummary(),
+		p.generateResponseSummary(),
+		p.generateHostnamesSummary(),
+	}
+}
+
+// Creates a finding with the given message, formatted like fmt.Sprintf, originating from the current packet
+func (p *Protocol) warning(format string, a ...interface{}) output.Finding {
+	return output.Finding{
+		Severity: output.SeverityWarning,
+		Message:  fmt.Sprintf(format, a...),
+		Source:   p.origin,
+	}
 }
@@ -3,8 +3,7 @@ package dhcpv4
 import (
 	"fmt"
 	"github.com/google/gopacket/layers"
-	"github.com/maride/pancap/common"
-	"log"
+	"github.com/maride/pancap/output"
 )
 
 func (p *Protocol) checkForHostname(dhcppacket layers.DHCPv4) {
@@ -36,7 +35,7 @@ func (p *Protocol) checkForHostname(dhcppacket layers.DHCPv4) {
 }
 
 // Generates the list of all hostnames encountered.
-func (p *Protocol) generateHostnamesSummary() string {
+func (p *Protocol) generateHostnamesSummary() output.Block {
 	var tmparr []string
 
 	// Construct meaningful text
@@ -67,8 +66,13 @@ func (p *Protocol) generateHostnamesSummary() string {
 		tmparr = append(tmparr, answer)
 	}
 
-	// and print it as a tree.
-	return common.GenerateTree(tmparr)
+	// and return it as a list, along with the findings
+	block := output.Block{Headline: "DHCP Hostnames"}
+	block.Add(output.List{Entries: tmparr})
+	for _, f := range p.hostnameFindings {
+		block.Add(f)
+	}
+	return block
 }
 
 // Adds the given hostname to the hostname array, or patches an existing entry if found
@@ -87,7 +91,7 @@ func (p *Protocol) addHostname(tmph hostname) {
 					// Same client asked for the same hostname - that's ok. Ignore.
 				} else {
 					// Different devices asked for the same hostname - log it.
-					log.Printf("Multiple clients (%s, %s) asked for the same hostname (%s)", h.requestedByMAC, tmph.requestedByMAC, h.hostname)
+					p.hostnameFindings = append(p.hostnameFindings, p.warning("Multiple clients (%s, %s) asked for the same hostname (%s)", h.requestedByMAC, tmph.requestedByMAC, h.hostname))
 				}
 			} else {
 				// Received a response for this hostname, check if it was granted
@@ -96,7 +100,7 @@ func (p *Protocol) addHostname(tmph hostname) {
 					p.hostnames[i].granted = true
 				} else {
 					// Received a different hostname than the one requested by the MAC. Report that.
-					log.Printf("Client %s asked for hostname '%s' but was given '%s' by DHCP server", h.requestedByMAC, tmph.hostname, h.hostname)
+					p.hostnameFindings = append(p.hostnameFindings, p.warning("Client %s asked for hostname '%s' but was given '%s' by DHCP server", h.requestedByMAC, tmph.hostname, h.hostname))
 					p.hostnames[i].deniedHostname = p.hostnames[i].hostname
 					p.hostnames[i].hostname = tmph.hostname
 					p.hostnames[i].granted = false
@@ -4,9 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"github.com/fatih/color"
 	"github.com/google/gopacket/layers"
-	"log"
+	"github.com/maride/pancap/output"
 	"net"
 )
 
@@ -23,7 +22,9 @@ var (
 )
 
 // Generates the summary of relevant DHCP options
-func (p *Protocol) generateNetworkSummary() string {
+func (p *Protocol) generateNetworkSummary() output.Block {
+	block := output.Block{Headline: "DHCP Network Overview"}
+
 	subnetMask, subnetAvail := formatIP(p.networkSetup[layers.DHCPOptSubnetMask])
 	broadcastAddr, broadcastAvail := formatIP(p.networkSetup[layers.DHCPOptBroadcastAddr])
 	routerAddr, routerAvail := formatIP(p.networkSetup[layers.DHCPOptRouter])
@@ -35,11 +36,22 @@ func (p *Protocol) generateNetworkSummary() string {
 	// Check if there even are any values
 	if !subnetAvail && !broadcastAvail && !routerAvail && !dnsAvail && !ntpAvail && !leaseAvail && !renewalAvail {
 		// No, do not return any summary. This will lead to a collapsed section.
-		return ""
+		return block
 	}
 
-	summary := fmt.Sprintf("Subnet Mask: %s\nBroadcast: %s\nRouter: %s\nDNS Server: %s\nNTP Server: %s\nLease Time: %s\nRenewal Time: %s", subnetMask, broadcastAddr, routerAddr, dnsAddr, ntpAddr, leaseTime, renewalTime)
-	return summary
+	block.Add(
+		output.Property{Name: "Subnet Mask", Value: subnetMask},
+		output.Property{Name: "Broadcast", Value: broadcastAddr},
+		output.Property{Name: "Router", Value: routerAddr},
+		output.Property{Name: "DNS Server", Value: dnsAddr},
+		output.Property{Name: "NTP Server", Value: ntpAddr},
+		output.Property{Name: "Lease Time", Value: leaseTime},
+		output.Property{Name: "Renewal Time", Value: renewalTime},
+	)
+	for _, f := range p.networkFindings {
+		block.Add(f)
+	}
+	return block
 }
 
 // Looks for information specifying the setup of the network. This includes
@@ -74,7 +86,7 @@ func (p *Protocol) saveOption(opt layers.DHCPOption) {
 		// We already stored a value, let's check if it's the same as the new one
 		if !bytes.Equal(p.networkSetup[opt.Type], opt.Data) {
 			// Already stored a value and it's different from our new value - inform user and overwrite value later
-			log.Printf("Received different values for DHCP Option %s (ID %d). (Old: %s, New. %s)", opt.Type.String(), opt.Type, p.networkSetup[opt.Type], opt.Data)
+			p.networkFindings = append(p.networkFindings, p.warning("Received different values for DHCP Option %s (ID %d). (Old: %s, New. %s)", opt.Type.String(), opt.Type, p.networkSetup[opt.Type], opt.Data))
 		} else {
 			// Exactly this value was already stored, no need to overwrite it
 			return
@@ -98,28 +110,26 @@ func isRelevantOption(opt layers.DHCPOption) bool {
 	return false
 }
 
-// Formats the given byte array as string representing the IP address, or returns an error (as string)
+// Formats the given byte array as string representing the IP address, or returns an empty string
 // The returned bool value states whether the IP address could be formatted or not (e.g. "not found")
 func formatIP(rawIP []byte) (string, bool) {
 	// Check if we even have an IP
 	if rawIP == nil {
-		// We don't have an IP, construct an error message (as string)
-		error := color.New(color.FgRed)
-		return error.Sprint("(not found)"), false
+		// We don't have an IP, leave it to the output to mark it as missing
+		return "", false
 	}
 
 	// Return formatted IP
 	return net.IP(rawIP).String(), true
 }
 
-// Formats the given byte array as string representing the date, or returns an error (as string)
+// Formats the given byte array as string representing the date, or returns an empty string
 // The returned bool value states whether the date could be formatted or not (e.g. "not found")
 func formatDate(rawDate []byte) (string, bool) {
 	// Check if we even have a date
 	if rawDate == nil {
-		// We don't have a date, construct an error message (as string)
-		error := color.New(color.FgRed)
-		return error.Sprint("(not found)"), false
+		// We don't have a date, leave it to the output to mark it as missing
+		return "", false
 	}
 
 	// Actually format date
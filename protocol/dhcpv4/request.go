@@ -1,9 +1,9 @@
 package dhcpv4
 
 import (
-	"fmt"
 	"github.com/google/gopacket/layers"
 	"github.com/maride/pancap/common"
+	"github.com/maride/pancap/output"
 )
 
 // Processes the DHCP request packet handed over
@@ -12,14 +12,17 @@ func (p *Protocol) processRequestPacket(dhcppacket layers.DHCPv4) {
 }
 
 // Generates the summary of all DHCP request packets
-func (p *Protocol) generateRequestSummary() string {
+func (p *Protocol) generateRequestSummary() output.Block {
+	block := output.Block{Headline: "DHCP Requests"}
 	reqAmount := len(p.requestMAC)
 
 	// Check if there were requests
 	if reqAmount == 0 {
-		// No, don't print a summary then.
-		return ""
+		// No, don't add a summary then.
+		return block
 	}
 
-	return fmt.Sprintf("%d unique DHCP requests\n%s", reqAmount, common.GenerateTree(p.requestMAC))
+	block.Add(output.Count{Name: "requests", Value: reqAmount, Label: "unique DHCP requests"})
+	block.Add(output.List{Entries: p.requestMAC})
+	return block
 }
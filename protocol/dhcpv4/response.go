@@ -3,8 +3,7 @@ package dhcpv4
 import (
 	"fmt"
 	"github.com/google/gopacket/layers"
-	"github.com/maride/pancap/common"
-	"log"
+	"github.com/maride/pancap/output"
 )
 
 func (p *Protocol) processResponsePacket(dhcppacket layers.DHCPv4, ethernetpacket layers.Ethernet) {
@@ -12,7 +11,7 @@ func (p *Protocol) processResponsePacket(dhcppacket layers.DHCPv4, ethernetpacke
 }
 
 // Generates the summary of all DHCP offer packets
-func (p *Protocol) generateResponseSummary() string {
+func (p *Protocol) generateResponseSummary() output.Block {
 	var tmpaddr []string
 
 	// Iterate over all responses
@@ -26,8 +25,13 @@ func (p *Protocol) generateResponseSummary() string {
 		tmpaddr = append(tmpaddr, fmt.Sprintf("%s offered %s IP address %s%s", r.serverMACAddr, r.destMACAddr, r.newIPAddr, addition))
 	}
 
-	// Draw as tree
-	return common.GenerateTree(tmpaddr)
+	// Return as list, along with the findings
+	block := output.Block{Headline: "DHCP Responses/Offers"}
+	block.Add(output.List{Entries: tmpaddr})
+	for _, f := range p.responseFindings {
+		block.Add(f)
+	}
+	return block
 }
 
 // Adds a new response entry. If an IP address was already issued or a MAC asks multiple times for DNS, the case is examined further
@@ -48,19 +52,19 @@ func (p *Protocol) addResponseEntry(newIP string, yourIP string, destMAC string,
 				// the handed IP is the same - this is ok, just badly configured
 				if r.serverMACAddr == serverMAC {
 					// Same DHCP server answered.
-					log.Printf("MAC address %s received the same IP address multiple times via DHCP by the same server.", destMAC)
+					p.responseFindings = append(p.responseFindings, p.warning("MAC address %s received the same IP address multiple times via DHCP by the same server.", destMAC))
 				} else {
 					// Different DHCP servers answered, but with the same address - strange network, but ok...
-					log.Printf("MAC address %s received the same IP address multiple times via DHCP by different servers.", destMAC)
+					p.responseFindings = append(p.responseFindings, p.warning("MAC address %s received the same IP address multiple times via DHCP by different servers.", destMAC))
 				}
 			} else {
 				// far more interesting - one client received multiple addresses
 				if r.serverMACAddr == serverMAC {
 					// Same DHCP server answered.
-					log.Printf("MAC address %s received different IP addresses (%s, %s) multiple times via DHCP by the same server.", destMAC, r.newIPAddr, newIP)
+					p.responseFindings = append(p.responseFindings, p.warning("MAC address %s received different IP addresses (%s, %s) multiple times via DHCP by the same server.", destMAC, r.newIPAddr, newIP))
 				} else {
 					// Different DHCP servers answered, with different addresses - possibly an attempt to build up MitM
-					log.Printf("MAC address %s received different IP addresses (%s, %s) multiple times via DHCP by different servers (%s, %s).", destMAC, r.newIPAddr, newIP, r.serverMACAddr, serverMAC)
+					p.responseFindings = append(p.responseFindings, p.warning("MAC address %s received different IP addresses (%s, %s) multiple times via DHCP by different servers (%s, %s).", destMAC, r.newIPAddr, newIP, r.serverMACAddr, serverMAC))
 				}
 			}
 		}
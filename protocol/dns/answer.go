@@ -1,28 +1,18 @@
 package dns
 
 import (
-	"fmt"
 	"github.com/google/gopacket/layers"
 	"github.com/maride/pancap/common"
+	"github.com/maride/pancap/output"
 	"golang.org/x/net/publicsuffix"
 	"log"
 )
 
-var (
-	numAnswers           int
-	answerDomains        []string
-	answerBaseDomains    []string
-	answerPrivateDomains []string
-	answerType           = make(map[layers.DNSType]int)
-	answerPublicIPv4     []string
-	answerPrivateIPv4    []string
-)
-
 // Called on every DNS packet to process response(s)
 func (p *Protocol) processDNSAnswer(answers []layers.DNSResourceRecord) {
 	for _, answer := range answers {
 		// Raise stats
-		numAnswers++
+		p.numAnswers++
 
 		// Add answer to answers array
 		name := string(answer.Name)
@@ -35,58 +25,59 @@ func (p *Protocol) processDNSAnswer(answers []layers.DNSResourceRecord) {
 		}
 
 		// Process type answers
-		p.processType(answerType, answer.Type)
+		p.processType(p.answerType, answer.Type)
 
 		// Append full domain and base domain
-		answerDomains = common.AppendIfUnique(name, answerDomains)
+		p.answerDomains = common.AppendIfUnique(name, p.answerDomains)
 
 		// Check if we need to add the base name to the private list
 		_, icannManaged := publicsuffix.PublicSuffix(name)
 		if icannManaged {
 			// TLD is managed by ICANN, add to the base list
-			answerBaseDomains = common.AppendIfUnique(basename, answerBaseDomains)
+			p.answerBaseDomains = common.AppendIfUnique(basename, p.answerBaseDomains)
 		} else {
 			// it's not managed by ICANN, so it's private - add it to the private list
-			answerPrivateDomains = common.AppendIfUnique(name, answerPrivateDomains)
+			p.answerPrivateDomains = common.AppendIfUnique(name, p.answerPrivateDomains)
 		}
 
 		// Check if we got an A record answer
 		if answer.Type == layers.DNSTypeA {
 			// A record, check IP for being private
 			if ipIsPrivate(answer.IP) {
-				answerPrivateIPv4 = common.AppendIfUnique(answer.IP.String(), answerPrivateIPv4)
+				p.answerPrivateIPv4 = common.AppendIfUnique(answer.IP.String(), p.answerPrivateIPv4)
 			} else {
-				answerPublicIPv4 = common.AppendIfUnique(answer.IP.String(), answerPublicIPv4)
+				p.answerPublicIPv4 = common.AppendIfUnique(answer.IP.String(), p.answerPublicIPv4)
 			}
 		}
 	}
 }
 
 // Generates a summary of all DNS answers
-func (p *Protocol) generateDNSAnswerSummary() string {
-	summary := ""
+func (p *Protocol) generateDNSAnswerSummary() output.Block {
+	block := output.Block{Headline: "DNS Response Summary"}
 
 	// Overall question stats
-	summary = fmt.Sprintf("%s%d DNS answers in total\n", summary, numAnswers)
-	summary = fmt.Sprintf("%s%s records\n", summary, p.generateDNSTypeSummary(answerType))
-	summary = fmt.Sprintf("%s%d unique domains of %d base domains, of which are %d private (non-ICANN) TLDs.\n", summary, len(answerDomains), len(answerBaseDomains), len(answerPrivateDomains))
+	block.Add(
+		output.Count{Name: "answers", Value: p.numAnswers, Label: "DNS answers in total"},
+		output.Count{Name: "domains", Value: len(p.answerDomains), Label: "unique domains"},
+		output.Count{Name: "baseDomains", Value: len(p.answerBaseDomains), Label: "base domains"},
+		output.Count{Name: "privateDomains", Value: len(p.answerPrivateDomains), Label: "private (non-ICANN) domains"},
+		p.generateDNSTypeTable(p.answerType),
+	)
 
 	// Output base domains answered with
-	if len(answerBaseDomains) > 0 {
-		summary = fmt.Sprintf("Answered with these base domains:\n%s", common.GenerateTree(answerBaseDomains))
-	}
+	block.Add(output.List{Title: "Answered with these base domains", Entries: p.answerBaseDomains})
 
 	// Output private domains
-	if len(answerPrivateDomains) > 0 {
-		summary = fmt.Sprintf("%sAnswered with these private (non-ICANN managed) domains:\n%s", summary, common.GenerateTree(answerPrivateDomains))
-	}
+	block.Add(output.List{Title: "Answered with these private (non-ICANN managed) domains", Entries: p.answerPrivateDomains})
 
 	// Check for public and private IPs
-	summary = fmt.Sprintf("%sAnswered with %d public IP addresses and %d private IP addresses\n", summary, len(answerPublicIPv4), len(answerPrivateIPv4))
-	if len(answerPrivateIPv4) > 0 {
-		summary = fmt.Sprintf("%sPrivate IP addresses in answer:\n%s", summary, common.GenerateTree(answerPrivateIPv4))
-	}
+	block.Add(
+		output.Count{Name: "publicIPs", Value: len(p.answerPublicIPv4), Label: "public IP addresses in answers"},
+		output.Count{Name: "privateIPs", Value: len(p.answerPrivateIPv4), Label: "private IP addresses in answers"},
+	)
+	block.Add(output.List{Title: "Private IP addresses in answer", Entries: p.answerPrivateIPv4})
 
 	// Return summary
-	return summary
+	return block
 }
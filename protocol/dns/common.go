@@ -1,18 +1,19 @@
 package dns
 
 import (
-	"fmt"
 	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/output"
 	"net"
+	"sort"
 )
 
 var (
 	privateBlocks = []net.IPNet{
-		{net.IPv4(10, 0, 0, 0), net.IPv4Mask(255, 0, 0, 0)},      // 10.0.0.0/8
-		{net.IPv4(172, 16, 0, 0), net.IPv4Mask(255, 240, 0, 0)},  // 172.16.0.0/12
-		{net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 0, 0)}, // 192.168.0.0/24
-		{net.IPv4(100, 64, 0, 0), net.IPv4Mask(255, 192, 0, 0)},  // 100.64.0.0/10
-		{net.IPv4(169, 254, 0, 0), net.IPv4Mask(255, 255, 0, 0)}, // 169.254.0.0/16
+		{IP: net.IPv4(10, 0, 0, 0), Mask: net.IPv4Mask(255, 0, 0, 0)},      // 10.0.0.0/8
+		{IP: net.IPv4(172, 16, 0, 0), Mask: net.IPv4Mask(255, 240, 0, 0)},  // 172.16.0.0/12
+		{IP: net.IPv4(192, 168, 0, 0), Mask: net.IPv4Mask(255, 255, 0, 0)}, // 192.168.0.0/24
+		{IP: net.IPv4(100, 64, 0, 0), Mask: net.IPv4Mask(255, 192, 0, 0)},  // 100.64.0.0/10
+		{IP: net.IPv4(169, 254, 0, 0), Mask: net.IPv4Mask(255, 255, 0, 0)}, // 169.254.0.0/16
 	}
 )
 
@@ -35,37 +36,23 @@ func ipIsPrivate(ip net.IP) bool {
 	return false
 }
 
-// Generates a summary string for DNS types in the given array
-func (p *Protocol) generateDNSTypeSummary(typearr map[layers.DNSType]int) string {
-	var answerarr []string
+// Generates a table of the DNS types in the given array, most frequent first
+func (p *Protocol) generateDNSTypeTable(typearr map[layers.DNSType]int) output.Table {
+	table := output.Table{Title: "Record types", Columns: []string{"Type", "Records"}}
 
-	// Iterate over all possible DNS types
-	for iter, typeelem := range typearr {
-		// Read amount of type hits for this type
-		answerarr = append(answerarr, fmt.Sprintf("%d %s", typeelem, iter.String()))
+	var types []layers.DNSType
+	for dnstype := range typearr {
+		types = append(types, dnstype)
 	}
-
-	// Check if we even processed a single type
-	if len(answerarr) == 0 {
-		// we didn't, strange.
-		return "(no types encountered)"
-	}
-
-	// now, glue all array elements together
-	answerstr := ""
-	for iter, elem := range answerarr {
-		// Check if we need to apply to proper sentence rules
-		if iter == 0 {
-			// We don't need to append yet
-			answerstr = elem
-		} else if iter == len(answerarr)-1 {
-			// Last element, use "and" instead of a comma
-			answerstr = fmt.Sprintf("%s and %s", answerstr, elem)
-		} else {
-			// Some entry, just add it with a comma
-			answerstr = fmt.Sprintf("%s, %s", answerstr, elem)
+	sort.Slice(types, func(i, j int) bool {
+		if typearr[types[i]] != typearr[types[j]] {
+			return typearr[types[i]] > typearr[types[j]]
 		}
-	}
+		return types[i] < types[j]
+	})
 
-	return answerstr
+	for _, dnstype := range types {
+		table.AddRow(dnstype.String(), typearr[dnstype])
+	}
+	return table
 }
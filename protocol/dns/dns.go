@@ -3,10 +3,46 @@ package dns
 import (
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/analyze/flow"
 	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/protocol"
 )
 
-type Protocol struct{}
+type Protocol struct {
+	flows                  *flow.Table
+	numQuestions           int
+	questionDomains        []string
+	questionBaseDomains    []string
+	questionPrivateDomains []string
+	questionType           map[layers.DNSType]int
+	numAnswers             int
+	answerDomains          []string
+	answerBaseDomains      []string
+	answerPrivateDomains   []string
+	answerType             map[layers.DNSType]int
+	answerPublicIPv4       []string
+	answerPrivateIPv4      []string
+}
+
+func init() {
+	protocol.Register(protocol.Module{
+		Name:        "dns",
+		Description: "Collects DNS questions and answers as hints of user actions",
+		Enabled:     true,
+		New: func(ctx *protocol.Context) protocol.Protocol {
+			return New(ctx.Flows)
+		},
+	})
+}
+
+// Creates a new DNS protocol module, annotating flows in the given table with the names asked for
+func New(flows *flow.Table) *Protocol {
+	return &Protocol{
+		flows:        flows,
+		questionType: make(map[layers.DNSType]int),
+		answerType:   make(map[layers.DNSType]int),
+	}
+}
 
 func (p *Protocol) CanAnalyze(packet gopacket.Packet) bool {
 	return packet.Layer(layers.LayerTypeDNS) != nil
@@ -27,12 +63,21 @@ func (p *Protocol) Analyze(packet gopacket.Packet) error {
 	p.processDNSQuestion(dnspacket.Questions)
 	p.processDNSAnswer(dnspacket.Answers)
 
+	// Note the name asked for on the flow
+	if len(dnspacket.Questions) > 0 && p.flows != nil {
+		if f := p.flows.Lookup(packet); f != nil {
+			f.Annotate("dns.query", string(dnspacket.Questions[0].Name))
+		}
+	}
+
 	// No error encountered, return clean
 	return nil
 }
 
-// Print a summary after all DNS packets were processed
-func (p *Protocol) PrintSummary() {
-	output.PrintBlock("DNS Request Summary", p.generateDNSQuestionSummary())
-	output.PrintBlock("DNS Response Summary", p.generateDNSAnswerSummary())
+// Returns the summary after all DNS packets were processed
+func (p *Protocol) Summary() []output.Block {
+	return []output.Block{
+		p.generateDNSQuestionSummary(),
+		p.generateDNSAnswerSummary(),
+	}
 }
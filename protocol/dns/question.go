@@ -1,27 +1,19 @@
 package dns
 
 import (
-	"fmt"
 	"github.com/google/gopacket/layers"
 	"github.com/maride/pancap/common"
+	"github.com/maride/pancap/output"
 	"golang.org/x/net/publicsuffix"
 	"log"
 )
 
-var (
-	numQuestions           int
-	questionDomains        []string
-	questionBaseDomains    []string
-	questionPrivateDomains []string
-	questionType           = make(map[layers.DNSType]int)
-)
-
 // Called on every DNS packet to process questions
 func (p *Protocol) processDNSQuestion(questions []layers.DNSQuestion) {
 	// Iterate over all questions
 	for _, question := range questions {
 		// Raise stats
-		numQuestions++
+		p.numQuestions++
 
 		// Add question to questions array
 		name := string(question.Name)
@@ -34,42 +26,42 @@ func (p *Protocol) processDNSQuestion(questions []layers.DNSQuestion) {
 		}
 
 		// Process type questions
-		p.processType(questionType, question.Type)
+		p.processType(p.questionType, question.Type)
 
 		// Append full domain and base domain
-		questionDomains = common.AppendIfUnique(name, questionDomains)
+		p.questionDomains = common.AppendIfUnique(name, p.questionDomains)
 
 		// Check if we need to add the base name to the private list
 		_, icannManaged := publicsuffix.PublicSuffix(name)
 		if icannManaged {
 			// TLD is managed by ICANN, add to the base list
-			questionBaseDomains = common.AppendIfUnique(basename, questionBaseDomains)
+			p.questionBaseDomains = common.AppendIfUnique(basename, p.questionBaseDomains)
 		} else {
 			// it's not managed by ICANN, so it's private - add it to the private list
-			questionPrivateDomains = common.AppendIfUnique(name, questionPrivateDomains)
+			p.questionPrivateDomains = common.AppendIfUnique(name, p.questionPrivateDomains)
 		}
 	}
 }
 
 // Generates a summary of all DNS questions
-func (p *Protocol) generateDNSQuestionSummary() string {
-	summary := ""
+func (p *Protocol) generateDNSQuestionSummary() output.Block {
+	block := output.Block{Headline: "DNS Request Summary"}
 
 	// Overall question stats
-	summary = fmt.Sprintf("%s%d DNS questions in total\n", summary, numQuestions)
-	summary = fmt.Sprintf("%s%s records\n", summary, p.generateDNSTypeSummary(questionType))
-	summary = fmt.Sprintf("%s%d unique domains of %d base domains, of which are %d private (non-ICANN) TLDs.\n", summary, len(questionDomains), len(questionBaseDomains), len(questionPrivateDomains))
+	block.Add(
+		output.Count{Name: "questions", Value: p.numQuestions, Label: "DNS questions in total"},
+		output.Count{Name: "domains", Value: len(p.questionDomains), Label: "unique domains"},
+		output.Count{Name: "baseDomains", Value: len(p.questionBaseDomains), Label: "base domains"},
+		output.Count{Name: "privateDomains", Value: len(p.questionPrivateDomains), Label: "private (non-ICANN) domains"},
+		p.generateDNSTypeTable(p.questionType),
+	)
 
 	// Output base domains asked for
-	if len(questionBaseDomains) > 0 {
-		summary = fmt.Sprintf("%sAsked for these base domains:\n%s", summary, common.GenerateTree(questionBaseDomains))
-	}
+	block.Add(output.List{Title: "Asked for these base domains", Entries: p.questionBaseDomains})
 
 	// Output private domains
-	if len(questionPrivateDomains) > 0 {
-		summary = fmt.Sprintf("%sAsked for these private (non-ICANN managed) domains:\n%s", summary, common.GenerateTree(questionPrivateDomains))
-	}
+	block.Add(output.List{Title: "Asked for these private (non-ICANN managed) domains", Entries: p.questionPrivateDomains})
 
 	// And return summary
-	return summary
+	return block
 }
@@ -0,0 +1,130 @@
+package hierarchy
+
+import (
+	"math"
+	"sort"
+
+	"github.com/google/gopacket"
+	"github.com/maride/pancap/common"
+	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/protocol"
+)
+
+type Protocol struct {
+	// Root of the hierarchy, counting all packets
+	root *node
+}
+
+// A single layer type at a certain position of the hierarchy, e.g. TCP inside of IPv4 inside of Ethernet
+type node struct {
+	name     string
+	packets  int
+	bytes    int
+	children map[string]*node
+}
+
+func init() {
+	protocol.Register(protocol.Module{
+		Name:        "hierarchy",
+		Description: "Builds the protocol hierarchy of all packets, like tshark -z io,phs",
+		Enabled:     true,
+		Observer:    true,
+		New: func(ctx *protocol.Context) protocol.Protocol {
+			return New()
+		},
+	})
+}
+
+// Creates a new protocol hierarchy module
+func New() *Protocol {
+	return &Protocol{
+		root: newNode(""),
+	}
+}
+
+// Creates an empty node with the given name
+func newNode(name string) *node {
+	return &node{
+		name:     name,
+		children: make(map[string]*node),
+	}
+}
+
+// Every packet is part of the hierarchy
+func (p *Protocol) CanAnalyze(packet gopacket.Packet) bool {
+	return true
+}
+
+// Adds the layers of the given packet to the hierarchy
+func (p *Protocol) Analyze(packet gopacket.Packet) error {
+	// Count the bytes on the wire, or the captured bytes if the length is unknown
+	length := packet.Metadata().Length
+	if length == 0 {
+		length = len(packet.Data())
+	}
+
+	current := p.root
+	current.packets++
+	current.bytes += length
+
+	// Walk down the layers, counting the packet on each of them
+	for _, l := range packet.Layers() {
+		name := l.LayerType().String()
+		child, ok := current.children[name]
+		if !ok {
+			child = newNode(name)
+			current.children[name] = child
+		}
+		child.packets++
+		child.bytes += length
+		current = child
+	}
+
+	return nil
+}
+
+// Returns the hierarchy as tree, listing each layer below its parent like tshark does
+func (p *Protocol) Summary() []output.Block {
+	block := output.Block{Headline: "Protocol hierarchy"}
+	block.Add(output.Tree{
+		Columns: []string{"Layer", "Packets", "Packets %", "Bytes", "Bytes %"},
+		Nodes:   p.treeNodes(p.root),
+	})
+	return []output.Block{block}
+}
+
+// Returns the tree nodes of the children of the given node, along with their counts and percentages of all packets
+func (p *Protocol) treeNodes(n *node) []common.TreeNode {
+	var nodes []common.TreeNode
+	for _, c := range n.sortedChildren() {
+		nodes = append(nodes, common.TreeNode{
+			Label:    c.name,
+			Values:   []interface{}{c.packets, percentage(c.packets, p.root.packets), c.bytes, percentage(c.bytes, p.root.bytes)},
+			Children: p.treeNodes(c),
+		})
+	}
+	return nodes
+}
+
+// Returns the children of the node, most frequent first
+func (n *node) sortedChildren() []*node {
+	children := make([]*node, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].packets != children[j].packets {
+			return children[i].packets > children[j].packets
+		}
+		return children[i].name < children[j].name
+	})
+	return children
+}
+
+// Returns part in percent of total, rounded to one decimal place
+func percentage(part int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)*1000/float64(total)) / 10
+}
@@ -0,0 +1,85 @@
+package hierarchy
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/common"
+	"github.com/maride/pancap/output"
+)
+
+// Returns an ethernet packet made of the given layers, with the given length on the wire
+func packet(t *testing.T, length int, l ...gopacket.SerializableLayer) gopacket.Packet {
+	buf := gopacket.NewSerializeBuffer()
+	if serializeErr := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, l...); serializeErr != nil {
+		t.Fatal(serializeErr)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	p.Metadata().Length = length
+	return p
+}
+
+func TestHierarchy(t *testing.T) {
+	ethernet := &layers.Ethernet{SrcMAC: net.HardwareAddr{2, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{2, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	tcp := &layers.TCP{SrcPort: 1234, DstPort: 4321, Window: 1024}
+	arpEthernet := &layers.Ethernet{SrcMAC: net.HardwareAddr{2, 0, 0, 0, 0, 1}, DstMAC: layers.EthernetBroadcast, EthernetType: layers.EthernetTypeARP}
+	arp := &layers.ARP{AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4,
+		Operation: layers.ARPRequest, SourceHwAddress: []byte{2, 0, 0, 0, 0, 1}, SourceProtAddress: []byte{10, 0, 0, 1},
+		DstHwAddress: make([]byte, 6), DstProtAddress: []byte{10, 0, 0, 2}}
+
+	p := New()
+	packets := []gopacket.Packet{
+		packet(t, 100, ethernet, ip, tcp, gopacket.Payload("hello")),
+		packet(t, 200, ethernet, ip, tcp),
+		packet(t, 100, arpEthernet, arp),
+	}
+	for _, pkt := range packets {
+		if !p.CanAnalyze(pkt) {
+			t.Fatal("packet not taken")
+		}
+		if analyzeErr := p.Analyze(pkt); analyzeErr != nil {
+			t.Fatal(analyzeErr)
+		}
+	}
+
+	blocks := p.Summary()
+	if len(blocks) != 1 || len(blocks[0].Items) != 1 {
+		t.Fatalf("got blocks %v, expected one block holding the tree", blocks)
+	}
+	tree, ok := blocks[0].Items[0].(output.Tree)
+	if !ok {
+		t.Fatalf("got %v, expected a tree", blocks[0].Items[0])
+	}
+
+	// Children are sorted by their packets, percentages are rounded to one decimal place
+	expected := []common.TreeNode{
+		{Label: "Ethernet", Values: []interface{}{3, 100.0, 400, 100.0}, Children: []common.TreeNode{
+			{Label: "IPv4", Values: []interface{}{2, 66.7, 300, 75.0}, Children: []common.TreeNode{
+				{Label: "TCP", Values: []interface{}{2, 66.7, 300, 75.0}, Children: []common.TreeNode{
+					{Label: "Payload", Values: []interface{}{1, 33.3, 100, 25.0}},
+				}},
+			}},
+			// Ethernet frames are padded to their minimum size, which shows up as payload of ARP
+			{Label: "ARP", Values: []interface{}{1, 33.3, 100, 25.0}, Children: []common.TreeNode{
+				{Label: "Payload", Values: []interface{}{1, 33.3, 100, 25.0}},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(tree.Nodes, expected) {
+		t.Errorf("got tree %v, expected %v", tree.Nodes, expected)
+	}
+	if len(tree.Columns) != 5 {
+		t.Errorf("got columns %v, expected a label column and four value columns", tree.Columns)
+	}
+}
+
+func TestEmptyHierarchy(t *testing.T) {
+	blocks := New().Summary()
+	if len(blocks) != 1 || len(blocks[0].Items) != 0 {
+		t.Errorf("got blocks %v, expected one empty block", blocks)
+	}
+}
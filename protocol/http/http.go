@@ -1,52 +1,176 @@
 package http
 
 import (
+	"bytes"
+	"sync"
+
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/tcpassembly"
-	"github.com/maride/pancap/common"
+	"github.com/maride/pancap/analyze/flow"
+	"github.com/maride/pancap/analyze/stream"
 	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/protocol"
+)
+
+var (
+	// Ports HTTP is usually spoken on
+	ports = []uint16{80, 8000, 8080}
+	// Start of client data in HTTP connections on other ports
+	methods = [][]byte{[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("HEAD "), []byte("DELETE "), []byte("OPTIONS "), []byte("PATCH ")}
 )
 
 type Protocol struct {
-	initialized       bool
-	requestFactory    *httpRequestFactory
-	responseFactory   *httpResponseFactory
-	requestPool       *tcpassembly.StreamPool
-	responsePool      *tcpassembly.StreamPool
-	requestAssembler  *tcpassembly.Assembler
-	responseAssembler *tcpassembly.Assembler
+	files                *output.FileManager
+	requestSummaryLines  []string
+	responseSummaryLines []string
+
+	// Stream readers run in the background, each one reporting its results at the index it got on creation
+	streams     sync.WaitGroup
+	resultsLock sync.Mutex
+	results     []*streamResult
+
+	// Connections on other ports detected as HTTP by the stream service, which runs on its own goroutine
+	detectedLock sync.Mutex
+	detected     map[flow.Key]bool
 }
 
-// Checks if the given packet is an HTTP packet we can process
+// Results of a single stream reader
+type streamResult struct {
+	requests  []string
+	responses []string
+	files     [][]byte
+	// Origin of the files, naming the flow they were found in
+	origin string
+}
+
+func init() {
+	protocol.Register(protocol.Module{
+		Name:        "http",
+		Description: "Reads reassembled TCP streams to dump cleartext HTTP communication and embedded files",
+		Enabled:     true,
+		New: func(ctx *protocol.Context) protocol.Protocol {
+			return New(ctx.Files, ctx.Streams)
+		},
+	})
+}
+
+// Creates a new HTTP protocol module, reading HTTP connections of the given stream service and registering found files with the given file manager
+func New(files *output.FileManager, streams *stream.Service) *Protocol {
+	p := &Protocol{
+		files:    files,
+		detected: make(map[flow.Key]bool),
+	}
+	streams.Subscribe(stream.Subscription{
+		Ports:  ports,
+		Detect: detect,
+		Handle: p.handle,
+	})
+	return p
+}
+
+// Checks if the given packet is sent to or from a port HTTP is usually spoken on, or belongs to a connection detected as HTTP.
+// Connections on other ports are detected on their first data, so the packets of the handshake aren't claimed.
 func (p *Protocol) CanAnalyze(packet gopacket.Packet) bool {
-	return packet.Layer(layers.LayerTypeTCP) != nil && packet.Layer(layers.LayerTypeTLS) == nil
+	tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok {
+		return false
+	}
+	if isHTTPPort(uint16(tcp.SrcPort), uint16(tcp.DstPort)) {
+		return true
+	}
+
+	key, _, ok := flow.KeyOf(packet)
+	if !ok {
+		return false
+	}
+	p.detectedLock.Lock()
+	defer p.detectedLock.Unlock()
+	return p.detected[key]
 }
 
-// Analyzes the given HTTP packet
+// Nothing to do, as the stream service reassembles the connections
 func (p *Protocol) Analyze(packet gopacket.Packet) error {
-	// Check if we need to init
-	if !p.initialized {
-		// Initialize
-		p.requestFactory = &httpRequestFactory{}
-		p.responseFactory = &httpResponseFactory{}
-		p.requestPool = tcpassembly.NewStreamPool(p.requestFactory)
-		p.responsePool = tcpassembly.NewStreamPool(p.responseFactory)
-		p.requestAssembler = tcpassembly.NewAssembler(p.requestPool)
-		p.responseAssembler = tcpassembly.NewAssembler(p.responsePool)
-		p.initialized = true
-	}
-
-	// Try to cast packet and assemble HTTP stream
-	tcp := packet.TransportLayer().(*layers.TCP)
-	p.requestAssembler.AssembleWithTimestamp(packet.NetworkLayer().NetworkFlow(), tcp, packet.Metadata().Timestamp)
-	p.responseAssembler.AssembleWithTimestamp(packet.NetworkLayer().NetworkFlow(), tcp, packet.Metadata().Timestamp)
+	return nil
+}
+
+// Waits for all stream readers, then collects their results in order of stream creation
+func (p *Protocol) Finalize() error {
+	p.streams.Wait()
+
+	// Collect results
+	for _, r := range p.results {
+		p.requestSummaryLines = append(p.requestSummaryLines, r.requests...)
+		p.responseSummaryLines = append(p.responseSummaryLines, r.responses...)
+		for _, f := range r.files {
+			p.files.RegisterFile("", f, r.origin)
+		}
+	}
 
 	return nil
 }
 
-// Print a summary after all packets are processed
-func (p *Protocol) PrintSummary() {
-	output.PrintBlock("HTTP Requests", common.GenerateTree(requestSummaryLines))
-	output.PrintBlock("HTTP Responses", common.GenerateTree(responseSummaryLines))
+// Returns the summary after all packets are processed
+func (p *Protocol) Summary() []output.Block {
+	requests := output.Block{Headline: "HTTP Requests"}
+	requests.Add(output.List{Entries: p.requestSummaryLines})
+	responses := output.Block{Headline: "HTTP Responses"}
+	responses.Add(output.List{Entries: p.responseSummaryLines})
+	return []output.Block{requests, responses}
+}
+
+// Checks if either of the given ports is one HTTP is usually spoken on
+func isHTTPPort(src uint16, dst uint16) bool {
+	for _, port := range ports {
+		if src == port || dst == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the first data of a connection looks like HTTP
+func detect(data []byte, fromClient bool) bool {
+	if !fromClient {
+		return bytes.HasPrefix(data, []byte("HTTP/1."))
+	}
+	for _, m := range methods {
+		if bytes.HasPrefix(data, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Starts reading requests and responses of the given connection in the background
+func (p *Protocol) handle(conn *stream.Conn) {
+	// Claim the further packets of connections on other ports, too
+	key := flow.KeyFromFlows(conn.Net, conn.Transport)
+	if !isHTTPPort(key.A.Port, key.B.Port) {
+		p.detectedLock.Lock()
+		p.detected[key] = true
+		p.detectedLock.Unlock()
+	}
+
+	go p.readRequests(conn, p.startStream())
+	go p.readResponses(conn, p.startStream())
+}
+
+// Registers a new stream reader, returning the index it should report its results at.
+// Called on the goroutine of the stream service only.
+func (p *Protocol) startStream() int {
+	p.streams.Add(1)
+
+	p.resultsLock.Lock()
+	defer p.resultsLock.Unlock()
+	p.results = append(p.results, nil)
+	return len(p.results) - 1
+}
+
+// Stores the results of the stream reader with the given index, and marks the reader as done
+func (p *Protocol) finishStream(index int, result *streamResult) {
+	p.resultsLock.Lock()
+	p.results[index] = result
+	p.resultsLock.Unlock()
+
+	p.streams.Done()
 }
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/analyze/stream"
+	"github.com/maride/pancap/output"
+)
+
+// Returns a TCP segment between 10.0.0.1:40000 and 10.0.0.2 on the given server port
+func segment(t *testing.T, fromClient bool, serverPort uint16, seq uint32, syn bool, payload string) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: layers.TCPPort(serverPort), Seq: seq, SYN: syn, ACK: !syn, Window: 1024}
+	if !fromClient {
+		ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+		tcp.SrcPort, tcp.DstPort = tcp.DstPort, tcp.SrcPort
+	}
+	tcp.SetNetworkLayerForChecksum(ip)
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if serializeErr := gopacket.SerializeLayers(buffer, options, ip, tcp, gopacket.Payload(payload)); serializeErr != nil {
+		t.Fatal(serializeErr)
+	}
+	p := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	p.Metadata().Timestamp = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	return p
+}
+
+func TestCanAnalyze(t *testing.T) {
+	streams := stream.NewService(nil, "")
+	p := New(output.NewFileManager(), streams)
+
+	// Ports HTTP is usually spoken on are claimed right away
+	if !p.CanAnalyze(segment(t, true, 8080, 1000, true, "")) {
+		t.Error("packet on port 8080 not claimed")
+	}
+
+	// Other ports are claimed once the connection was detected as HTTP
+	handshake := segment(t, true, 1234, 1000, true, "")
+	request := segment(t, true, 1234, 1001, false, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	if p.CanAnalyze(handshake) {
+		t.Error("packet on port 1234 claimed before the connection was detected")
+	}
+	streams.Add(handshake)
+	streams.Add(request)
+	streams.Close()
+	if finalizeErr := p.Finalize(); finalizeErr != nil {
+		t.Fatal(finalizeErr)
+	}
+	if !p.CanAnalyze(request) || !p.CanAnalyze(segment(t, false, 1234, 5000, false, "HTTP/1.1 200 OK\r\n\r\n")) {
+		t.Error("packets of the connection detected as HTTP not claimed")
+	}
+	if len(p.requestSummaryLines) != 1 || p.requestSummaryLines[0] != "Request GET http://example.com/" {
+		t.Errorf("got requests %v, expected the GET request", p.requestSummaryLines)
+	}
+
+	// Other connections are not
+	if p.CanAnalyze(segment(t, true, 1235, 1000, true, "")) {
+		t.Error("packet of another connection claimed")
+	}
+}
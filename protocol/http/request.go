@@ -0,0 +1,46 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/maride/pancap/analyze/stream"
+)
+
+// Analyzes the requests sent by the client of the given connection
+func (p *Protocol) readRequests(conn *stream.Conn, index int) {
+	iobuf := bufio.NewReader(conn.Client)
+	result := &streamResult{}
+	defer p.finishStream(index, result)
+
+	for {
+		req, reqErr := http.ReadRequest(iobuf)
+
+		if reqErr == io.EOF || reqErr == io.ErrUnexpectedEOF {
+			// That's ok, we can ignore EOF errors - but the stream ends here
+			return
+		} else if reqErr != nil {
+			// Not a request, e.g. because data was lost - skip to the next line and try again
+			if _, skipErr := iobuf.ReadString('\n'); skipErr != nil {
+				ioutil.ReadAll(iobuf)
+				return
+			}
+		} else {
+			// Try to process assembled request
+			ioutil.ReadAll(req.Body)
+			req.Body.Close()
+
+			// Build summary
+			line := fmt.Sprintf("Request %s http://%s%s", req.Method, req.Host, req.RequestURI)
+			result.requests = append(result.requests, line)
+
+			// Note the host on the flow, so others can see what it is about
+			if conn.Flow != nil && req.Host != "" {
+				conn.Flow.Annotate("http.host", req.Host)
+			}
+		}
+	}
+}
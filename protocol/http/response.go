@@ -0,0 +1,52 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/maride/pancap/analyze/stream"
+)
+
+// Analyzes the responses sent by the server of the given connection
+func (p *Protocol) readResponses(conn *stream.Conn, index int) {
+	iobuf := bufio.NewReader(conn.Server)
+	result := &streamResult{origin: "HTTP response"}
+	defer p.finishStream(index, result)
+
+	// Name the flow the files are found in, and the file it was captured in if several files were merged
+	if conn.Flow != nil {
+		result.origin = fmt.Sprintf("HTTP response in flow %s", conn.Flow)
+		if conn.Flow.Origin != "" {
+			result.origin += fmt.Sprintf(" of %s", conn.Flow.Origin)
+		}
+	}
+
+	for {
+		resp, respErr := http.ReadResponse(iobuf, nil)
+
+		if respErr == io.EOF || respErr == io.ErrUnexpectedEOF {
+			// That's ok, we can ignore EOF errors - but the stream ends here
+			return
+		} else if respErr != nil {
+			// Not a response, e.g. because data was lost - skip to the next line and try again
+			if _, skipErr := iobuf.ReadString('\n'); skipErr != nil {
+				ioutil.ReadAll(iobuf)
+				return
+			}
+		} else {
+			// Try to process assembled response
+			fileBytes, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			// Remember file, it is registered in filemanager after all streams are done
+			result.files = append(result.files, fileBytes)
+
+			// Build summary
+			line := fmt.Sprintf("Response %s, Type %s, Size %d bytes", resp.Status, resp.Header.Get("Content-Type"), resp.ContentLength)
+			result.responses = append(result.responses, line)
+		}
+	}
+}
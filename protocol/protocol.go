@@ -1,9 +1,20 @@
 package protocol
 
-import "github.com/google/gopacket"
+import (
+	"github.com/google/gopacket"
+	"github.com/maride/pancap/output"
+)
 
 type Protocol interface {
 	CanAnalyze(gopacket.Packet) bool
 	Analyze(gopacket.Packet) error
-	PrintSummary()
+	// Summary returns the results of the analysis as blocks, rendered by the output package
+	Summary() []output.Block
+}
+
+// Finalizer is implemented by modules which need to finish their work after the last packet was analyzed,
+// e.g. to flush buffered streams and wait for background goroutines.
+// Finalize is called exactly once, after the last call to Analyze and before Summary.
+type Finalizer interface {
+	Finalize() error
 }
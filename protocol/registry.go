@@ -0,0 +1,167 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/maride/pancap/analyze/flow"
+	"github.com/maride/pancap/analyze/stream"
+	"github.com/maride/pancap/common"
+	"github.com/maride/pancap/output"
+)
+
+// Module describes a protocol module, as registered by the module itself
+type Module struct {
+	// Short name of the module, used to select it, e.g. "dns"
+	Name string
+	// Description shown to the user
+	Description string
+	// Whether the module runs if the user didn't select modules explicitly
+	Enabled bool
+	// Whether the module only observes packets without understanding them, e.g. to gather statistics.
+	// Packets seen by observers only still count as unprocessed.
+	Observer bool
+	// Settings of the module the user may change, see Context.Option
+	Options []Option
+	// Creates a fresh instance of the module for a single analysis
+	New func(ctx *Context) Protocol
+}
+
+// Option is a setting of a module, given by the user as "<module>.<name>", e.g. "usbkeyboard.layout"
+type Option struct {
+	Name        string
+	Description string
+	Default     string
+	// Checks a value given by the user, optional
+	Validate func(value string) error
+}
+
+// Context holds everything a module instance may need from the analysis it is part of
+type Context struct {
+	Files *output.FileManager
+	// Flows seen in the analysis, filled before modules see a packet
+	Flows *flow.Table
+	// Reassembled TCP connections, subscribed to while creating the module
+	Streams *stream.Service
+	// Amount of entries shown in top lists, e.g. of hosts
+	Top int
+	// Values of module options given by the user, by "<module>.<name>". Checked with CheckOptions before.
+	Options map[string]string
+}
+
+var modules []Module
+
+// Registers the given module. Meant to be called from the init function of the module package.
+func Register(m Module) {
+	for _, r := range modules {
+		if r.Name == m.Name {
+			panic(fmt.Sprintf("protocol module %s registered twice", m.Name))
+		}
+	}
+	modules = append(modules, m)
+
+	// Keep modules sorted by name, as the order of init functions is not meant to be relied on
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Name < modules[j].Name
+	})
+}
+
+// Returns all registered modules, sorted by name
+func Modules() []Module {
+	return modules
+}
+
+// Selects modules by name. If enable is empty, all modules enabled by default are selected.
+// Modules listed in skip are removed from the selection afterwards.
+func Select(enable []string, skip []string) ([]Module, error) {
+	// Check if all given names are known
+	for _, name := range append(append([]string{}, enable...), skip...) {
+		if !isRegistered(name) {
+			return nil, fmt.Errorf("unknown module '%s'", name)
+		}
+	}
+
+	var selected []Module
+	for _, m := range modules {
+		// Check if the module is wanted at all
+		if len(enable) > 0 {
+			if !common.Contains(enable, m.Name) {
+				continue
+			}
+		} else if !m.Enabled {
+			continue
+		}
+
+		// ... and not explicitly skipped
+		if common.Contains(skip, m.Name) {
+			continue
+		}
+
+		selected = append(selected, m)
+	}
+
+	return selected, nil
+}
+
+// Creates a fresh instance of each of the given modules
+func New(ctx *Context, selected []Module) []Protocol {
+	var protocols []Protocol
+	for _, m := range selected {
+		protocols = append(protocols, m.New(ctx))
+	}
+	return protocols
+}
+
+// Checks if a module with the given name is registered
+func isRegistered(name string) bool {
+	for _, m := range modules {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the given module options, by "<module>.<name>", for unknown names and invalid values
+func CheckOptions(options map[string]string) error {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		o, found := lookupOption(key)
+		if !found {
+			return fmt.Errorf("unknown module option '%s'", key)
+		}
+		if o.Validate != nil {
+			if validateErr := o.Validate(options[key]); validateErr != nil {
+				return fmt.Errorf("invalid value '%s' for %s: %s", options[key], key, validateErr.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// Option returns the value of the given option of the given module, as given by the user or its default
+func (c *Context) Option(module string, name string) string {
+	key := module + "." + name
+	if value, ok := c.Options[key]; ok {
+		return value
+	}
+	o, _ := lookupOption(key)
+	return o.Default
+}
+
+// Returns the option with the given "<module>.<name>"
+func lookupOption(key string) (Option, bool) {
+	for _, m := range modules {
+		for _, o := range m.Options {
+			if m.Name+"."+o.Name == key {
+				return o, true
+			}
+		}
+	}
+	return Option{}, false
+}
@@ -0,0 +1,189 @@
+package usbkeyboard
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/protocol"
+	"github.com/maride/pancap/usb"
+)
+
+const (
+	// Modifier bits of a boot protocol keyboard report
+	modifierCtrl  = 0x01 | 0x10
+	modifierShift = 0x02 | 0x20
+	modifierAlt   = 0x04
+	modifierAltGr = 0x40
+
+	// Keys with a special meaning while reconstructing the typed text
+	keyBackspace = 0x2a
+	keyCapsLock  = 0x39
+)
+
+type Protocol struct {
+	layout     layout
+	layoutName string
+	keyboards  map[string]*keyboard
+}
+
+// A single keyboard, identified by its endpoint
+type keyboard struct {
+	endpoint   string
+	pressed    []byte
+	capsLock   bool
+	keystrokes int
+	// Typed text, one entry per keystroke so that backspace removes whole keys like "<Up>"
+	typed []string
+}
+
+func init() {
+	protocol.Register(protocol.Module{
+		Name:        "usbkeyboard",
+		Description: "Reconstructs the text typed on USB keyboards",
+		Enabled:     true,
+		Options: []protocol.Option{{
+			Name:        "layout",
+			Description: fmt.Sprintf("Layout of keyboards typing in USB captures: %s", strings.Join(Layouts(), ", ")),
+			Default:     "us",
+			Validate:    checkLayout,
+		}},
+		New: func(ctx *protocol.Context) protocol.Protocol {
+			return New(ctx.Option("usbkeyboard", "layout"))
+		},
+	})
+}
+
+// Checks if the given keyboard layout is known
+func checkLayout(name string) error {
+	if _, ok := layouts[name]; !ok {
+		return fmt.Errorf("unknown keyboard layout, available layouts are %s", strings.Join(Layouts(), ", "))
+	}
+	return nil
+}
+
+// Creates a new USB keyboard module, reconstructing the typed text for the given keyboard layout (e.g. "us").
+// Unknown layouts fall back to "us".
+func New(layoutName string) *Protocol {
+	l, ok := layouts[layoutName]
+	if !ok {
+		layoutName = "us"
+		l = layouts[layoutName]
+	}
+
+	return &Protocol{
+		layout:     l,
+		layoutName: layoutName,
+		keyboards:  make(map[string]*keyboard),
+	}
+}
+
+// Checks if the given packet carries a keyboard report
+func (p *Protocol) CanAnalyze(packet gopacket.Packet) bool {
+	transfer, ok := usb.Decode(packet)
+	return ok && usb.IsKeyboardReport(transfer)
+}
+
+// Reconstructs the keys pressed in the given keyboard report
+func (p *Protocol) Analyze(packet gopacket.Packet) error {
+	transfer, ok := usb.Decode(packet)
+	if !ok || !usb.IsKeyboardReport(transfer) {
+		return nil
+	}
+
+	k, found := p.keyboards[transfer.EndpointID()]
+	if !found {
+		k = &keyboard{endpoint: transfer.EndpointID()}
+		p.keyboards[k.endpoint] = k
+	}
+
+	report := transfer.Data
+	modifiers := report[0]
+	keys := report[2:8]
+
+	// Keys pressed in the previous report are still held, only newly pressed keys count
+	for _, key := range keys {
+		if key == 0 || bytes.IndexByte(k.pressed, key) >= 0 {
+			continue
+		}
+		k.press(p.layout, key, modifiers)
+	}
+	k.pressed = append(k.pressed[:0], keys...)
+
+	return nil
+}
+
+// Returns a block for each keyboard, sorted by endpoint
+func (p *Protocol) Summary() []output.Block {
+	var endpoints []string
+	for e := range p.keyboards {
+		endpoints = append(endpoints, e)
+	}
+	sort.Strings(endpoints)
+
+	var blocks []output.Block
+	for _, e := range endpoints {
+		k := p.keyboards[e]
+		block := output.Block{Headline: fmt.Sprintf("USB keyboard %s", k.endpoint)}
+		block.Add(
+			output.Count{Name: "keystrokes", Value: k.keystrokes, Label: fmt.Sprintf("keystrokes, decoded with %s layout", p.layoutName)},
+			output.List{Title: "Typed text", Entries: strings.Split(strings.Join(k.typed, ""), "\n")},
+		)
+		blocks = append(blocks, block)
+	}
+
+	// Keep an empty block, so the module shows up if empty blocks are printed
+	if len(blocks) == 0 {
+		blocks = append(blocks, output.Block{Headline: "USB keyboards"})
+	}
+	return blocks
+}
+
+// Adds the given newly pressed key to the typed text
+func (k *keyboard) press(l layout, key byte, modifiers byte) {
+	k.keystrokes++
+
+	switch key {
+	case keyBackspace:
+		if len(k.typed) > 0 {
+			k.typed = k.typed[:len(k.typed)-1]
+		}
+		return
+	case keyCapsLock:
+		k.capsLock = !k.capsLock
+		return
+	}
+
+	chars, printable := l.chars(key)
+	if !printable {
+		k.typed = append(k.typed, keyName(key))
+		return
+	}
+
+	// AltGr is also reachable with Ctrl+Alt
+	altGr := modifiers&modifierAltGr != 0 || (modifiers&modifierCtrl != 0 && modifiers&modifierAlt != 0)
+	if altGr && chars[2] != "" {
+		k.typed = append(k.typed, chars[2])
+		return
+	}
+
+	// Caps lock only affects letters, and is reverted by shift
+	shift := modifiers&modifierShift != 0
+	if k.capsLock && strings.ToUpper(chars[0]) == chars[1] {
+		shift = !shift
+	}
+	char := chars[0]
+	if shift {
+		char = chars[1]
+	}
+
+	// Shortcuts like Ctrl+C don't produce text, but may be interesting anyway
+	if modifiers&modifierCtrl != 0 && !altGr {
+		char = fmt.Sprintf("<Ctrl+%s>", strings.ToUpper(chars[0]))
+	}
+
+	k.typed = append(k.typed, char)
+}
@@ -0,0 +1,127 @@
+package usbkeyboard
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/protocol"
+	"github.com/maride/pancap/usb"
+)
+
+// Returns a USBPcap packet carrying the given keyboard report, sent by endpoint 1 of device 3 on bus 1
+func reportPacket(modifiers byte, keys ...byte) gopacket.Packet {
+	data := make([]byte, 27+8)
+	binary.LittleEndian.PutUint16(data[0:2], 27)
+	data[16] = 0x01
+	binary.LittleEndian.PutUint16(data[17:19], 1)
+	binary.LittleEndian.PutUint16(data[19:21], 3)
+	data[21] = 0x81
+	data[22] = byte(usb.TransferInterrupt)
+	binary.LittleEndian.PutUint32(data[23:27], 8)
+	data[27] = modifiers
+	copy(data[29:], keys)
+	return gopacket.NewPacket(data, usb.LayerTypeUSBPcap, gopacket.Default)
+}
+
+// Feeds the given reports to a fresh module with the given layout, and returns the typed text
+func typed(t *testing.T, layoutName string, reports []gopacket.Packet) []string {
+	p := New(layoutName)
+	for i, r := range reports {
+		if !p.CanAnalyze(r) {
+			t.Fatalf("report %d is not recognized as keyboard report", i)
+		}
+		if analyzeErr := p.Analyze(r); analyzeErr != nil {
+			t.Fatalf("report %d: %s", i, analyzeErr)
+		}
+	}
+
+	blocks := p.Summary()
+	if len(blocks) != 1 || blocks[0].Headline != "USB keyboard 1.3.1" {
+		t.Fatalf("got blocks %v, expected one for keyboard 1.3.1", blocks)
+	}
+	for _, item := range blocks[0].Items {
+		if list, ok := item.(output.List); ok {
+			return list.Entries
+		}
+	}
+	return nil
+}
+
+func TestTypedText(t *testing.T) {
+	const shift, ctrl, altGr = 0x02, 0x01, 0x40
+
+	tests := []struct {
+		layout  string
+		reports []gopacket.Packet
+		text    []string
+	}{
+		{"us", []gopacket.Packet{
+			// Shift+H, i held for two reports, then released
+			reportPacket(shift, 0x0b), reportPacket(0), reportPacket(0, 0x0c), reportPacket(0, 0x0c), reportPacket(0),
+			// Space removed by backspace, Shift+2, Ctrl+C and enter
+			reportPacket(0, 0x2c), reportPacket(0, 0x2a), reportPacket(shift, 0x1f), reportPacket(ctrl, 0x06), reportPacket(0, 0x28),
+			// Arrow keys are named, and removed by backspace as a whole
+			reportPacket(0, 0x52), reportPacket(0, 0x51), reportPacket(0, 0x2a), reportPacket(0),
+		}, []string{"Hi@<Ctrl+C>", "<Up>"}},
+		{"us", []gopacket.Packet{
+			// Two keys pressed in the same report, then a third while both are held
+			reportPacket(0, 0x04, 0x05), reportPacket(0, 0x04, 0x05, 0x06), reportPacket(0),
+			// Caps lock affects letters only, and is reverted by shift
+			reportPacket(0, 0x39), reportPacket(0, 0x07), reportPacket(0, 0x1e), reportPacket(shift, 0x08), reportPacket(0),
+		}, []string{"abcD1e"}},
+		{"de", []gopacket.Packet{
+			reportPacket(0, 0x1c), reportPacket(0, 0x1d), reportPacket(shift, 0x1f), reportPacket(altGr, 0x14),
+			reportPacket(ctrl|0x04, 0x08), reportPacket(0, 0x33),
+		}, []string{"zy\"@€ö"}},
+	}
+
+	for i, test := range tests {
+		text := typed(t, test.layout, test.reports)
+		if len(text) != len(test.text) {
+			t.Errorf("test %d: got %q, expected %q", i, text, test.text)
+			continue
+		}
+		for j := range text {
+			if text[j] != test.text[j] {
+				t.Errorf("test %d: got %q, expected %q", i, text, test.text)
+				break
+			}
+		}
+	}
+}
+
+func TestRejectedReports(t *testing.T) {
+	p := New("us")
+	// Phantom state reported by keyboards if too many keys are pressed at once
+	if p.CanAnalyze(reportPacket(0, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01)) {
+		t.Errorf("rollover report is recognized as keyboard report")
+	}
+	// Reserved byte not zero, as sent by other HID devices like mice
+	mouse := reportPacket(0, 0x04)
+	mouse.Data()[28] = 1
+	if p.CanAnalyze(gopacket.NewPacket(mouse.Data(), usb.LayerTypeUSBPcap, gopacket.Default)) {
+		t.Errorf("report with reserved byte set is recognized as keyboard report")
+	}
+}
+
+func TestLayoutOption(t *testing.T) {
+	if checkErr := protocol.CheckOptions(map[string]string{"usbkeyboard.layout": "de"}); checkErr != nil {
+		t.Errorf("known layout rejected: %s", checkErr)
+	}
+	if checkErr := protocol.CheckOptions(map[string]string{"usbkeyboard.layout": "dvorak"}); checkErr == nil {
+		t.Errorf("unknown layout accepted")
+	}
+	if checkErr := protocol.CheckOptions(map[string]string{"usbkeyboard.speed": "fast"}); checkErr == nil {
+		t.Errorf("unknown option accepted")
+	}
+
+	ctx := &protocol.Context{Options: map[string]string{"usbkeyboard.layout": "de"}}
+	if layout := ctx.Option("usbkeyboard", "layout"); layout != "de" {
+		t.Errorf("got layout %s, expected de", layout)
+	}
+	if layout := (&protocol.Context{}).Option("usbkeyboard", "layout"); layout != "us" {
+		t.Errorf("got layout %s, expected the default us", layout)
+	}
+}
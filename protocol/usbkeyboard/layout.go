@@ -0,0 +1,75 @@
+package usbkeyboard
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Characters produced by a key without modifiers, with shift, and with AltGr
+type keyChars [3]string
+
+// Maps HID usage IDs of printable keys to the characters they produce
+type layout map[byte]keyChars
+
+var layouts = map[string]layout{
+	"us": {
+		0x1e: {"1", "!"}, 0x1f: {"2", "@"}, 0x20: {"3", "#"}, 0x21: {"4", "$"}, 0x22: {"5", "%"},
+		0x23: {"6", "^"}, 0x24: {"7", "&"}, 0x25: {"8", "*"}, 0x26: {"9", "("}, 0x27: {"0", ")"},
+		0x2d: {"-", "_"}, 0x2e: {"=", "+"}, 0x2f: {"[", "{"}, 0x30: {"]", "}"}, 0x31: {"\\", "|"},
+		0x32: {"#", "~"}, 0x33: {";", ":"}, 0x34: {"'", "\""}, 0x35: {"`", "~"}, 0x36: {",", "<"},
+		0x37: {".", ">"}, 0x38: {"/", "?"}, 0x64: {"\\", "|"},
+	},
+	"de": {
+		0x1c: {"z", "Z"}, 0x1d: {"y", "Y"},
+		0x14: {"q", "Q", "@"}, 0x08: {"e", "E", "€"}, 0x10: {"m", "M", "µ"},
+		0x1e: {"1", "!"}, 0x1f: {"2", "\"", "²"}, 0x20: {"3", "§", "³"}, 0x21: {"4", "$"}, 0x22: {"5", "%"},
+		0x23: {"6", "&"}, 0x24: {"7", "/", "{"}, 0x25: {"8", "(", "["}, 0x26: {"9", ")", "]"}, 0x27: {"0", "=", "}"},
+		0x2d: {"ß", "?", "\\"}, 0x2e: {"´", "`"}, 0x2f: {"ü", "Ü"}, 0x30: {"+", "*", "~"}, 0x31: {"#", "'"},
+		0x32: {"#", "'"}, 0x33: {"ö", "Ö"}, 0x34: {"ä", "Ä"}, 0x35: {"^", "°"}, 0x36: {",", ";"},
+		0x37: {".", ":"}, 0x38: {"-", "_"}, 0x64: {"<", ">", "|"},
+	},
+}
+
+// Keys producing the same result on all layouts, or no character at all
+var commonKeys = map[byte]string{
+	0x28: "\n", 0x29: "<Esc>", 0x2b: "\t", 0x2c: " ",
+	0x3a: "<F1>", 0x3b: "<F2>", 0x3c: "<F3>", 0x3d: "<F4>", 0x3e: "<F5>", 0x3f: "<F6>",
+	0x40: "<F7>", 0x41: "<F8>", 0x42: "<F9>", 0x43: "<F10>", 0x44: "<F11>", 0x45: "<F12>",
+	0x46: "<PrintScreen>", 0x48: "<Pause>", 0x49: "<Insert>", 0x4a: "<Home>", 0x4b: "<PageUp>",
+	0x4c: "<Del>", 0x4d: "<End>", 0x4e: "<PageDown>", 0x4f: "<Right>", 0x50: "<Left>", 0x51: "<Down>", 0x52: "<Up>",
+	0x54: "/", 0x55: "*", 0x56: "-", 0x57: "+", 0x58: "\n",
+	0x59: "1", 0x5a: "2", 0x5b: "3", 0x5c: "4", 0x5d: "5", 0x5e: "6", 0x5f: "7", 0x60: "8", 0x61: "9", 0x62: "0", 0x63: ".",
+}
+
+// Layouts returns the names of all supported keyboard layouts
+func Layouts() []string {
+	var names []string
+	for name := range layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the characters produced by the given key on this layout, or false if the key doesn't produce characters
+func (l layout) chars(key byte) (keyChars, bool) {
+	if chars, ok := l[key]; ok {
+		return chars, true
+	}
+
+	// Letters are at the same place on all supported layouts, except for the ones overridden above
+	if key >= 0x04 && key <= 0x1d {
+		letter := string(rune('a' + key - 0x04))
+		return keyChars{letter, string(rune('A' + key - 0x04))}, true
+	}
+
+	return keyChars{}, false
+}
+
+// Returns a readable name for a key which doesn't produce characters
+func keyName(key byte) string {
+	if name, ok := commonKeys[key]; ok {
+		return name
+	}
+	return fmt.Sprintf("<0x%02x>", key)
+}
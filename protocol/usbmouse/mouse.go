@@ -0,0 +1,198 @@
+package usbmouse
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/google/gopacket"
+	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/protocol"
+	"github.com/maride/pancap/usb"
+)
+
+const (
+	// Report ID of pen tablet reports with absolute coordinates, as sent e.g. by Wacom tablets
+	tabletReportID = 0x02
+	// Bits of a tablet report stating that the pen is in range, and that its tip touches the tablet
+	tabletInRange = 0xe0
+	tabletTip     = 0x01
+)
+
+type Protocol struct {
+	files   *output.FileManager
+	devices map[string]*device
+}
+
+// A single mouse or pen tablet, identified by its endpoint
+type device struct {
+	endpoint string
+	tablet   bool
+	reports  int
+
+	// Current position, and the strokes drawn while a button was held or the pen touched the tablet
+	x, y    int
+	drawing bool
+	strokes [][]point
+
+	// Hashes of the plots registered with the file manager
+	pngHash, svgHash string
+}
+
+// A position on the plotted path
+type point struct {
+	x, y int
+}
+
+func init() {
+	protocol.Register(protocol.Module{
+		Name:        "usbmouse",
+		Description: "Plots the paths drawn with USB mice and pen tablets",
+		Enabled:     true,
+		New: func(ctx *protocol.Context) protocol.Protocol {
+			return New(ctx.Files)
+		},
+	})
+}
+
+// Creates a new USB mouse module, registering the plotted paths as images with the given file manager
+func New(files *output.FileManager) *Protocol {
+	return &Protocol{
+		files:   files,
+		devices: make(map[string]*device),
+	}
+}
+
+// Checks if the given packet carries a mouse or tablet report
+func (p *Protocol) CanAnalyze(packet gopacket.Packet) bool {
+	transfer, ok := usb.Decode(packet)
+	return ok && (isTabletReport(transfer) || isMouseReport(transfer))
+}
+
+// Moves the mouse or pen as stated by the given report, drawing while a button is held
+func (p *Protocol) Analyze(packet gopacket.Packet) error {
+	transfer, ok := usb.Decode(packet)
+	if !ok {
+		return nil
+	}
+
+	tablet := isTabletReport(transfer)
+	if !tablet && !isMouseReport(transfer) {
+		return nil
+	}
+
+	d, found := p.devices[transfer.EndpointID()]
+	if !found {
+		d = &device{endpoint: transfer.EndpointID(), tablet: tablet}
+		p.devices[d.endpoint] = d
+	}
+	d.reports++
+
+	report := transfer.Data
+	var pressed bool
+	if tablet {
+		// Tablets report absolute coordinates
+		pressed = report[1]&tabletTip != 0
+		d.x = int(binary.LittleEndian.Uint16(report[2:4]))
+		d.y = int(binary.LittleEndian.Uint16(report[4:6]))
+	} else {
+		// Mice report relative movements, either as single bytes like in the boot protocol, or as 16 bit values
+		pressed = report[0]&0x07 != 0
+		if len(report) <= 5 {
+			d.x += int(int8(report[1]))
+			d.y += int(int8(report[2]))
+		} else {
+			d.x += int(int16(binary.LittleEndian.Uint16(report[1:3])))
+			d.y += int(int16(binary.LittleEndian.Uint16(report[3:5])))
+		}
+	}
+
+	// Start a new stroke when the button gets pressed, and continue it while it's held
+	if pressed {
+		if !d.drawing {
+			d.strokes = append(d.strokes, nil)
+		}
+		last := len(d.strokes) - 1
+		d.strokes[last] = append(d.strokes[last], point{d.x, d.y})
+	}
+	d.drawing = pressed
+
+	return nil
+}
+
+// Renders the drawn paths of all devices and registers them as files
+func (p *Protocol) Finalize() error {
+	for _, d := range p.sortedDevices() {
+		if len(d.strokes) == 0 {
+			continue
+		}
+		name := fmt.Sprintf("usb-%s-%s", d.kind(), d.endpoint)
+		origin := fmt.Sprintf("Path drawn with USB %s %s", d.kind(), d.endpoint)
+
+		png, pngErr := renderPNG(d.strokes)
+		if pngErr != nil {
+			return pngErr
+		}
+		d.pngHash = p.files.RegisterFile(name+".png", png, origin)
+		d.svgHash = p.files.RegisterFile(name+".svg", renderSVG(d.strokes), origin)
+	}
+	return nil
+}
+
+// Returns a block for each device, sorted by endpoint
+func (p *Protocol) Summary() []output.Block {
+	var blocks []output.Block
+	for _, d := range p.sortedDevices() {
+		block := output.Block{Headline: fmt.Sprintf("USB %s %s", d.kind(), d.endpoint)}
+		block.Add(output.Count{Name: "reports", Value: d.reports, Label: "reports"})
+		if len(d.strokes) > 0 {
+			block.Add(output.Text{Line: fmt.Sprintf("Drew %d strokes, plotted as PNG %s and SVG %s", len(d.strokes), d.pngHash, d.svgHash)})
+		} else {
+			block.Add(output.Text{Line: "Nothing was drawn, as no button was held while moving"})
+		}
+		blocks = append(blocks, block)
+	}
+
+	// Keep an empty block, so the module shows up if empty blocks are printed
+	if len(blocks) == 0 {
+		blocks = append(blocks, output.Block{Headline: "USB mice and tablets"})
+	}
+	return blocks
+}
+
+// Returns all devices, sorted by endpoint
+func (p *Protocol) sortedDevices() []*device {
+	var devices []*device
+	for _, d := range p.devices {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].endpoint < devices[j].endpoint
+	})
+	return devices
+}
+
+// Returns whether the device is a mouse or a tablet
+func (d *device) kind() string {
+	if d.tablet {
+		return "tablet"
+	}
+	return "mouse"
+}
+
+// Checks if the given transfer is a report of a pen tablet, with absolute coordinates and pressure
+func isTabletReport(t *usb.Transfer) bool {
+	return isReport(t) && len(t.Data) >= 8 && t.Data[0] == tabletReportID && t.Data[1]&tabletInRange != 0 && !usb.IsKeyboardReport(t)
+}
+
+// Checks if the given transfer is a report of a mouse, starting with the buttons followed by the relative movement.
+// Keyboard reports stating that too many keys are pressed would pass for mouse reports, so they are ruled out explicitly.
+func isMouseReport(t *usb.Transfer) bool {
+	return isReport(t) && len(t.Data) >= 3 && len(t.Data) <= 8 && t.Data[0] < 0x20 &&
+		!usb.IsKeyboardReport(t) && !usb.IsKeyboardRollOver(t) && !isTabletReport(t)
+}
+
+// Checks if the given transfer is a HID report, sent by the device
+func isReport(t *usb.Transfer) bool {
+	return t.Type == usb.TransferInterrupt && t.In && t.Completion
+}
@@ -0,0 +1,139 @@
+package usbmouse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/usb"
+)
+
+// Returns a USBPcap packet carrying the given HID report, sent by endpoint 1 of device 3 on bus 1
+func reportPacket(report ...byte) gopacket.Packet {
+	data := make([]byte, 27+len(report))
+	binary.LittleEndian.PutUint16(data[0:2], 27)
+	data[16] = 0x01
+	binary.LittleEndian.PutUint16(data[17:19], 1)
+	binary.LittleEndian.PutUint16(data[19:21], 3)
+	data[21] = 0x81
+	data[22] = byte(usb.TransferInterrupt)
+	binary.LittleEndian.PutUint32(data[23:27], uint32(len(report)))
+	copy(data[27:], report)
+	return gopacket.NewPacket(data, usb.LayerTypeUSBPcap, gopacket.Default)
+}
+
+// Returns a tablet report with the pen at the given absolute position, touching the tablet if tip is set
+func tabletReport(x, y uint16, tip bool) gopacket.Packet {
+	report := make([]byte, 8)
+	report[0] = tabletReportID
+	report[1] = tabletInRange
+	if tip {
+		report[1] |= tabletTip
+	}
+	binary.LittleEndian.PutUint16(report[2:4], x)
+	binary.LittleEndian.PutUint16(report[4:6], y)
+	return reportPacket(report...)
+}
+
+// Feeds the given reports to a fresh module, and returns the only device seen
+func analyze(t *testing.T, p *Protocol, reports []gopacket.Packet) *device {
+	for i, r := range reports {
+		if !p.CanAnalyze(r) {
+			t.Fatalf("report %d is not recognized as mouse or tablet report", i)
+		}
+		if analyzeErr := p.Analyze(r); analyzeErr != nil {
+			t.Fatalf("report %d: %s", i, analyzeErr)
+		}
+	}
+	devices := p.sortedDevices()
+	if len(devices) != 1 || devices[0].endpoint != "1.3.1" {
+		t.Fatalf("got %d devices, expected endpoint 1.3.1", len(devices))
+	}
+	return devices[0]
+}
+
+func TestStrokes(t *testing.T) {
+	tests := []struct {
+		name    string
+		reports []gopacket.Packet
+		tablet  bool
+		strokes [][]point
+	}{
+		{"boot mouse", []gopacket.Packet{
+			// Moving without a button held isn't drawn
+			reportPacket(0x00, 10, 10), reportPacket(0x01, 5, 0), reportPacket(0x01, 0, 0xfb), reportPacket(0x00, 0xf6, 0),
+			// A click without movement is a stroke of a single point
+			reportPacket(0x02, 0, 0), reportPacket(0x00, 0, 0),
+		}, false, [][]point{{{15, 10}, {15, 5}}, {{5, 5}}}},
+		{"16 bit mouse", []gopacket.Packet{
+			reportPacket(0x01, 0x2c, 0x01, 0x00, 0x00, 0x00), reportPacket(0x01, 0x00, 0x00, 0x38, 0xff, 0x00),
+		}, false, [][]point{{{300, 0}, {300, -200}}}},
+		{"tablet", []gopacket.Packet{
+			// The pen hovers in range, then touches the tablet, is lifted and touches it again
+			tabletReport(100, 100, false), tabletReport(200, 300, true), tabletReport(250, 300, true),
+			tabletReport(400, 400, false), tabletReport(500, 500, true),
+		}, true, [][]point{{{200, 300}, {250, 300}}, {{500, 500}}}},
+	}
+
+	for _, test := range tests {
+		d := analyze(t, New(output.NewFileManager()), test.reports)
+		if d.tablet != test.tablet || d.reports != len(test.reports) {
+			t.Errorf("%s: got tablet %t with %d reports, expected %t with %d", test.name, d.tablet, d.reports, test.tablet, len(test.reports))
+		}
+		if !reflect.DeepEqual(d.strokes, test.strokes) {
+			t.Errorf("%s: got strokes %v, expected %v", test.name, d.strokes, test.strokes)
+		}
+	}
+}
+
+func TestRejectedReports(t *testing.T) {
+	p := New(output.NewFileManager())
+	for name, report := range map[string]gopacket.Packet{
+		"keyboard":          reportPacket(0x02, 0x00, 0x0b, 0, 0, 0, 0, 0),
+		"keyboard rollover": reportPacket(0x00, 0x00, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01),
+		"too short":         reportPacket(0x01, 0x05),
+		"too long":          reportPacket(0x01, 0, 0, 0, 0, 0, 0, 0, 0),
+	} {
+		if p.CanAnalyze(report) {
+			t.Errorf("%s report is recognized as mouse report", name)
+		}
+	}
+}
+
+func TestPlots(t *testing.T) {
+	files := output.NewFileManager()
+	p := New(files)
+	d := analyze(t, p, []gopacket.Packet{reportPacket(0x01, 0, 0), reportPacket(0x01, 100, 50), reportPacket(0x01, 0, 50)})
+	if finalizeErr := p.Finalize(); finalizeErr != nil {
+		t.Fatal(finalizeErr)
+	}
+
+	registered := files.Files()
+	if len(registered) != 2 {
+		t.Fatalf("got %d files, expected a PNG and an SVG", len(registered))
+	}
+	img, decodeErr := png.Decode(bytes.NewReader(registered[0].Content()))
+	if decodeErr != nil {
+		t.Fatalf("PNG plot doesn't decode: %s", decodeErr)
+	}
+	// The drawing spans 100 by 100 points, which is enlarged eight times at most
+	if size := img.Bounds().Size(); size.X != 8*100+2*plotMargin+1 || size.Y != size.X {
+		t.Errorf("got PNG plot of %v", size)
+	}
+	svg := string(registered[1].Content())
+	if !strings.HasPrefix(svg, "<svg") || strings.Count(svg, "<polyline") != 1 {
+		t.Errorf("got SVG plot %q, expected a single polyline", svg)
+	}
+
+	// The summary names the plots by the hashes they are extracted as
+	line := p.Summary()[0].Items[1].(output.Text).Line
+	if d.pngHash != registered[0].Hash() || d.svgHash != registered[1].Hash() ||
+		!strings.Contains(line, registered[0].Hash()) || !strings.Contains(line, registered[1].Hash()) {
+		t.Errorf("got summary %q, expected the hashes %s and %s", line, registered[0].Hash(), registered[1].Hash())
+	}
+}
@@ -0,0 +1,162 @@
+package usbmouse
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+const (
+	// Longest side of a plot in pixels, and the margin around the path
+	plotSize   = 1024
+	plotMargin = 16
+)
+
+// Maps coordinates of the drawn path to coordinates of the plot
+type scaler struct {
+	minX, minY    int
+	scale         float64
+	width, height int
+}
+
+// Creates a scaler fitting all given strokes into the plot, keeping their aspect ratio
+func newScaler(strokes [][]point) scaler {
+	minX, minY, maxX, maxY := math.MaxInt32, math.MaxInt32, math.MinInt32, math.MinInt32
+	for _, stroke := range strokes {
+		for _, p := range stroke {
+			minX, maxX = min(minX, p.x), max(maxX, p.x)
+			minY, maxY = min(minY, p.y), max(maxY, p.y)
+		}
+	}
+
+	// Scale the longest side to the size of the plot, but don't enlarge tiny drawings too much
+	extent := max(max(maxX-minX, maxY-minY), 1)
+	scale := math.Min(float64(plotSize-2*plotMargin)/float64(extent), 8)
+
+	return scaler{
+		minX:   minX,
+		minY:   minY,
+		scale:  scale,
+		width:  int(float64(maxX-minX)*scale) + 2*plotMargin + 1,
+		height: int(float64(maxY-minY)*scale) + 2*plotMargin + 1,
+	}
+}
+
+// Returns the position of the given point on the plot
+func (s scaler) apply(p point) (int, int) {
+	return int(float64(p.x-s.minX)*s.scale) + plotMargin, int(float64(p.y-s.minY)*s.scale) + plotMargin
+}
+
+// Renders the given strokes as PNG image, black on white
+func renderPNG(strokes [][]point) ([]byte, error) {
+	s := newScaler(strokes)
+	img := image.NewRGBA(image.Rect(0, 0, s.width, s.height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+
+	for _, stroke := range strokes {
+		for i := range stroke {
+			// Single points are drawn as well, e.g. for clicks without movement
+			from := stroke[i]
+			if i > 0 {
+				from = stroke[i-1]
+			}
+			x0, y0 := s.apply(from)
+			x1, y1 := s.apply(stroke[i])
+			drawLine(img, x0, y0, x1, y1)
+		}
+	}
+
+	var buf bytes.Buffer
+	if encodeErr := png.Encode(&buf, img); encodeErr != nil {
+		return nil, encodeErr
+	}
+	return buf.Bytes(), nil
+}
+
+// Renders the given strokes as SVG image, one polyline per stroke
+func renderSVG(strokes [][]point) []byte {
+	s := newScaler(strokes)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\">\n", s.width, s.height)
+	fmt.Fprintf(&buf, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n")
+	for _, stroke := range strokes {
+		buf.WriteString("<polyline fill=\"none\" stroke=\"black\" stroke-width=\"2\" stroke-linecap=\"round\" points=\"")
+		for i, p := range stroke {
+			x, y := s.apply(p)
+			if i > 0 {
+				buf.WriteString(" ")
+			}
+			fmt.Fprintf(&buf, "%d,%d", x, y)
+		}
+		// A polyline needs at least two points to be visible
+		if len(stroke) == 1 {
+			x, y := s.apply(stroke[0])
+			fmt.Fprintf(&buf, " %d,%d", x, y)
+		}
+		buf.WriteString("\"/>\n")
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+// Draws a line two pixels wide, using Bresenham's algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := sign(x1-x0), sign(y1-y0)
+	e := dx + dy
+
+	for {
+		for _, o := range []image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+			img.Set(x0+o.X, y0+o.Y, color.Black)
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func sign(a int) int {
+	if a < 0 {
+		return -1
+	}
+	if a > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package usbstorage
+
+const (
+	// Block size assumed until the device reports its own
+	defaultBlockSize = 512
+
+	// Disk images are cut off at this size, as devices are often probed at their very end.
+	// Blocks are only kept up to this size in total, and files are only recovered up to this size in total.
+	maxImageSize = 256 << 20
+)
+
+// A sparse disk, holding the blocks read from or written to a logical unit of a device
+type disk struct {
+	blockSize uint32
+	// Number of blocks as reported by the device, 0 if unknown
+	capacity uint64
+
+	blocks        map[uint64][]byte
+	written       map[uint64]bool
+	blocksRead    int
+	blocksWritten int
+	// Blocks not kept, as maxImageSize was reached
+	blocksDropped int
+	// Whether the disk image was cut off at maxImageSize
+	truncated bool
+
+	// Files carved from the disk
+	filesystem string
+	files      []carvedFile
+}
+
+// Creates a new, empty disk
+func newDisk() *disk {
+	return &disk{
+		blockSize: defaultBlockSize,
+		blocks:    make(map[uint64][]byte),
+		written:   make(map[uint64]bool),
+	}
+}
+
+// Sets the capacity of the disk as reported by READ CAPACITY, i.e. the address of the last block and the block size
+func (d *disk) setCapacity(lastBlock uint64, blockSize uint32) {
+	// Check if the block size is sane, and if it can still be changed
+	if blockSize < 512 || blockSize > 65536 || (len(d.blocks) > 0 && blockSize != d.blockSize) {
+		return
+	}
+	d.blockSize = blockSize
+	d.capacity = lastBlock + 1
+}
+
+// Stores the given data at the given block address, returning the number of complete blocks transferred.
+// Later data replaces earlier data, so the disk reflects the most recent state seen.
+// A block stays marked as written by the host if it is read back later.
+// New blocks are dropped once maxImageSize bytes are kept.
+func (d *disk) store(address uint64, data []byte, written bool) int {
+	size := int(d.blockSize)
+	n := 0
+	for ; (n+1)*size <= len(data); n++ {
+		block, known := d.blocks[address+uint64(n)]
+		if !known {
+			if (len(d.blocks)+1)*size > maxImageSize {
+				d.blocksDropped++
+				continue
+			}
+			block = make([]byte, size)
+			d.blocks[address+uint64(n)] = block
+		}
+		copy(block, data[n*size:])
+		d.written[address+uint64(n)] = d.written[address+uint64(n)] || written
+	}
+	return n
+}
+
+// Reads length bytes at the given byte offset. Returns the data, with blocks never seen filled with zeroes,
+// the number of bytes actually seen, and whether any of the blocks were written by the host.
+func (d *disk) readAt(offset int64, length int) ([]byte, int, bool) {
+	data := make([]byte, length)
+	present, written := d.visit(offset, length, func(pos int64, block []byte) {
+		copy(data[pos:], block)
+	})
+	return data, present, written
+}
+
+// Returns the number of bytes seen at the given byte offset, and whether any of the blocks were written by the host,
+// without reading the data
+func (d *disk) presentAt(offset int64, length int) (int, bool) {
+	return d.visit(offset, length, func(pos int64, block []byte) {})
+}
+
+// Calls found with the position relative to offset and the data of each part of the given range which was seen.
+// Returns the number of bytes seen, and whether any of the blocks were written by the host.
+func (d *disk) visit(offset int64, length int, found func(pos int64, block []byte)) (int, bool) {
+	size := int64(d.blockSize)
+	present := 0
+	written := false
+
+	for pos := int64(0); pos < int64(length); {
+		address := (offset + pos) / size
+		start := (offset + pos) % size
+		n := size - start
+		if n > int64(length)-pos {
+			n = int64(length) - pos
+		}
+		if block, ok := d.blocks[uint64(address)]; ok {
+			found(pos, block[start:start+n])
+			present += int(n)
+			written = written || d.written[uint64(address)]
+		}
+		pos += n
+	}
+	return present, written
+}
+
+// Returns an image of the disk from its first block up to the last one seen, with blocks never seen filled with
+// zeroes. The image is cut off at maxImageSize, which is stated by the second return value.
+func (d *disk) image() ([]byte, bool) {
+	limit := uint64(maxImageSize / d.blockSize)
+	var end uint64
+	truncated := false
+	for address := range d.blocks {
+		if address >= limit {
+			truncated = true
+			continue
+		}
+		if address+1 > end {
+			end = address + 1
+		}
+	}
+
+	data, _, _ := d.readAt(0, int(end*uint64(d.blockSize)))
+	return data, truncated
+}
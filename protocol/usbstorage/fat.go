@@ -0,0 +1,373 @@
+package usbstorage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// Attributes of a directory entry
+	attributeVolumeLabel = 0x08
+	attributeDirectory   = 0x10
+	attributeLongName    = 0x0f
+
+	// Markers in the first byte of a directory entry's name
+	entryEnd     = 0x00
+	entryDeleted = 0xe5
+
+	// Directories nested deeper than this are not followed
+	maxDirectoryDepth = 16
+	// Directories hold at most 65536 entries of 32 bytes each
+	maxDirectorySize = 65536 * 32
+)
+
+// A file found on a disk. Its data is only read from the disk on demand, as it may be huge or incomplete.
+type carvedFile struct {
+	path string
+	size int
+	// Number of bytes of the file actually seen in the capture
+	present int
+	// Whether any part of the file was written by the host
+	written bool
+	// Whether the file was registered, which is skipped once maxImageSize bytes of files are registered
+	registered bool
+
+	fs      *fatFilesystem
+	cluster uint32
+}
+
+// Checks if the complete file was seen in the capture
+func (f carvedFile) complete() bool {
+	return f.present == f.size
+}
+
+// Reads the data of the file from the disk
+func (f carvedFile) read() []byte {
+	data := make([]byte, 0, f.size)
+	f.fs.followChain(f.cluster, f.size, func(offset int64, length int) {
+		chunk, _, _ := f.fs.disk.readAt(offset, length)
+		data = append(data, chunk...)
+	})
+	return data
+}
+
+// A FAT12, FAT16 or FAT32 file system on a disk
+type fatFilesystem struct {
+	disk *disk
+	// Byte offset of the file system on the disk
+	base int64
+
+	kind              string
+	bytesPerSector    int64
+	sectorsPerCluster int64
+	reservedSectors   int64
+	fats              int64
+	fatSectors        int64
+	rootEntries       int64
+	rootCluster       uint32
+	dataSector        int64
+	clusters          uint32
+}
+
+// Looks for FAT file systems on the given disk, either spanning the whole disk or in one of the partitions
+// of its master boot record, and returns the files found on them.
+func carve(d *disk) (string, []carvedFile) {
+	// Check if the disk is formatted without a partition table, as many USB sticks are
+	if fs, ok := newFatFilesystem(d, 0); ok {
+		return fs.kind, fs.files()
+	}
+
+	// Check the partitions listed in the master boot record
+	mbr, present, _ := d.readAt(0, 512)
+	if present < 512 || mbr[510] != 0x55 || mbr[511] != 0xaa {
+		return "", nil
+	}
+
+	var kinds []string
+	var files []carvedFile
+	for i := 0; i < 4; i++ {
+		entry := mbr[446+16*i : 446+16*(i+1)]
+		start := int64(binary.LittleEndian.Uint32(entry[8:12]))
+		if entry[4] == 0 || start == 0 {
+			continue
+		}
+		if fs, ok := newFatFilesystem(d, start*int64(d.blockSize)); ok {
+			kinds = append(kinds, fmt.Sprintf("%s in partition %d", fs.kind, i+1))
+			files = append(files, fs.files()...)
+		}
+	}
+	return strings.Join(kinds, ", "), files
+}
+
+// Parses the boot sector at the given byte offset of the disk, returning false if it doesn't hold a FAT file system
+func newFatFilesystem(d *disk, base int64) (*fatFilesystem, bool) {
+	boot, present, _ := d.readAt(base, 512)
+	if present < 512 || boot[510] != 0x55 || boot[511] != 0xaa {
+		return nil, false
+	}
+
+	fs := &fatFilesystem{
+		disk:              d,
+		base:              base,
+		bytesPerSector:    int64(binary.LittleEndian.Uint16(boot[11:13])),
+		sectorsPerCluster: int64(boot[13]),
+		reservedSectors:   int64(binary.LittleEndian.Uint16(boot[14:16])),
+		fats:              int64(boot[16]),
+		rootEntries:       int64(binary.LittleEndian.Uint16(boot[17:19])),
+		fatSectors:        int64(binary.LittleEndian.Uint16(boot[22:24])),
+	}
+	totalSectors := int64(binary.LittleEndian.Uint16(boot[19:21]))
+	if totalSectors == 0 {
+		totalSectors = int64(binary.LittleEndian.Uint32(boot[32:36]))
+	}
+	if fs.fatSectors == 0 {
+		// FAT32 keeps the size of the FAT and the first cluster of the root directory in its extended boot sector
+		fs.fatSectors = int64(binary.LittleEndian.Uint32(boot[36:40]))
+		fs.rootCluster = binary.LittleEndian.Uint32(boot[44:48])
+	}
+
+	// Check if the boot sector is sane
+	switch fs.bytesPerSector {
+	case 512, 1024, 2048, 4096:
+	default:
+		return nil, false
+	}
+	if fs.sectorsPerCluster == 0 || fs.sectorsPerCluster&(fs.sectorsPerCluster-1) != 0 || fs.reservedSectors == 0 ||
+		fs.fats == 0 || fs.fats > 2 || fs.fatSectors == 0 {
+		return nil, false
+	}
+
+	rootSectors := (fs.rootEntries*32 + fs.bytesPerSector - 1) / fs.bytesPerSector
+	fs.dataSector = fs.reservedSectors + fs.fats*fs.fatSectors + rootSectors
+	if totalSectors <= fs.dataSector {
+		return nil, false
+	}
+	fs.clusters = uint32((totalSectors - fs.dataSector) / fs.sectorsPerCluster)
+
+	// The type of a FAT file system is determined by its number of clusters only
+	switch {
+	case fs.clusters < 4085:
+		fs.kind = "FAT12"
+	case fs.clusters < 65525:
+		fs.kind = "FAT16"
+	default:
+		fs.kind = "FAT32"
+		if fs.rootCluster < 2 {
+			return nil, false
+		}
+	}
+	return fs, true
+}
+
+// Returns all files of the file system, walking down from the root directory
+func (fs *fatFilesystem) files() []carvedFile {
+	visited := make(map[uint32]bool)
+	if fs.kind == "FAT32" {
+		return fs.walk(fs.readDirectory(fs.rootCluster), "", 0, visited)
+	}
+
+	// FAT12 and FAT16 keep the root directory in a fixed region in front of the data
+	offset := fs.base + (fs.reservedSectors+fs.fats*fs.fatSectors)*fs.bytesPerSector
+	root, _, _ := fs.disk.readAt(offset, int(fs.rootEntries*32))
+	return fs.walk(root, "", 0, visited)
+}
+
+// Returns the files listed in the given directory and its subdirectories
+func (fs *fatFilesystem) walk(directory []byte, parent string, depth int, visited map[uint32]bool) []carvedFile {
+	var files []carvedFile
+	var longName []uint16
+	var longNameChecksum byte
+
+	for i := 0; i+32 <= len(directory); i += 32 {
+		entry := directory[i : i+32]
+		if entry[0] == entryEnd {
+			break
+		}
+		if entry[0] == entryDeleted {
+			longName = nil
+			continue
+		}
+
+		// Long file names are spread over several entries in front of the short entry, the last part coming first
+		if entry[11] == attributeLongName {
+			order := int(entry[0] & 0x1f)
+			if entry[0]&0x40 != 0 {
+				longName = make([]uint16, 13*order)
+				longNameChecksum = entry[13]
+			}
+			if order == 0 || 13*order > len(longName) || entry[13] != longNameChecksum {
+				longName = nil
+				continue
+			}
+			part := longName[13*(order-1) : 13*order]
+			for j, offset := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+				part[j] = binary.LittleEndian.Uint16(entry[offset : offset+2])
+			}
+			continue
+		}
+
+		name := shortName(entry)
+		if longName != nil && longNameChecksum == shortNameChecksum(entry) {
+			name = decodeLongName(longName)
+		}
+		longName = nil
+		if entry[11]&attributeVolumeLabel != 0 || name == "." || name == ".." {
+			continue
+		}
+
+		filePath := path.Join(parent, name)
+		cluster := uint32(binary.LittleEndian.Uint16(entry[20:22]))<<16 | uint32(binary.LittleEndian.Uint16(entry[26:28]))
+		size := int(binary.LittleEndian.Uint32(entry[28:32]))
+
+		// Descend into subdirectories, taking care of loops in broken file systems
+		if entry[11]&attributeDirectory != 0 {
+			if depth < maxDirectoryDepth && cluster >= 2 && !visited[cluster] {
+				visited[cluster] = true
+				files = append(files, fs.walk(fs.readDirectory(cluster), filePath, depth+1, visited)...)
+			}
+			continue
+		}
+
+		// The size is taken from the disk, so don't trust it to fit into the file system
+		if int64(size) > int64(fs.clusters)*fs.sectorsPerCluster*fs.bytesPerSector {
+			size = int(int64(fs.clusters) * fs.sectorsPerCluster * fs.bytesPerSector)
+		}
+		if size == 0 || cluster < 2 {
+			continue
+		}
+
+		// Only count the bytes seen for now, the data is read once it is known to be complete
+		file := carvedFile{path: filePath, size: size, fs: fs, cluster: cluster}
+		fs.followChain(cluster, size, func(offset int64, length int) {
+			present, written := fs.disk.presentAt(offset, length)
+			file.present += present
+			file.written = file.written || written
+		})
+		files = append(files, file)
+	}
+	return files
+}
+
+// Reads the directory starting at the given cluster
+func (fs *fatFilesystem) readDirectory(cluster uint32) []byte {
+	var data []byte
+	fs.followChain(cluster, -1, func(offset int64, length int) {
+		chunk, _, _ := fs.disk.readAt(offset, length)
+		data = append(data, chunk...)
+	})
+	return data
+}
+
+// Follows the cluster chain starting at the given cluster, calling visit with the byte offset and length of each
+// cluster on the disk. For directories, size is -1 and the chain is followed up to its end, or up to maxDirectorySize.
+func (fs *fatFilesystem) followChain(cluster uint32, size int, visit func(offset int64, length int)) {
+	clusterSize := int(fs.sectorsPerCluster * fs.bytesPerSector)
+	remaining := size
+	if size < 0 {
+		remaining = maxDirectorySize
+	}
+
+	for n := uint32(0); n < fs.clusters && cluster >= 2 && cluster < fs.clusters+2; n++ {
+		length := clusterSize
+		if remaining < length {
+			length = remaining
+		}
+		visit(fs.base+(fs.dataSector+int64(cluster-2)*fs.sectorsPerCluster)*fs.bytesPerSector, length)
+		remaining -= length
+		if remaining == 0 {
+			break
+		}
+
+		next, known := fs.next(cluster)
+		if !known {
+			// Without the FAT, files are assumed to be stored contiguously, as they mostly are on fresh media.
+			// Directories are assumed to fit into a single cluster.
+			if size < 0 {
+				break
+			}
+			next = cluster + 1
+		}
+		cluster = next
+	}
+}
+
+// Looks up the cluster following the given one in the FAT, checking all copies of the FAT.
+// Returns false if the FAT wasn't seen, or if the cluster is marked as free.
+func (fs *fatFilesystem) next(cluster uint32) (uint32, bool) {
+	for i := int64(0); i < fs.fats; i++ {
+		fat := fs.base + (fs.reservedSectors+i*fs.fatSectors)*fs.bytesPerSector
+
+		var next, end uint32
+		switch fs.kind {
+		case "FAT12":
+			entry, present, _ := fs.disk.readAt(fat+int64(cluster)*3/2, 2)
+			if present < 2 {
+				continue
+			}
+			next, end = uint32(binary.LittleEndian.Uint16(entry)), 0xff8
+			if cluster%2 == 1 {
+				next >>= 4
+			}
+			next &= 0xfff
+		case "FAT16":
+			entry, present, _ := fs.disk.readAt(fat+int64(cluster)*2, 2)
+			if present < 2 {
+				continue
+			}
+			next, end = uint32(binary.LittleEndian.Uint16(entry)), 0xfff8
+		default:
+			entry, present, _ := fs.disk.readAt(fat+int64(cluster)*4, 4)
+			if present < 4 {
+				continue
+			}
+			next, end = binary.LittleEndian.Uint32(entry)&0x0fffffff, 0x0ffffff8
+		}
+
+		if next == 0 {
+			return 0, false
+		}
+		if next >= end {
+			// End of the chain
+			return 0, true
+		}
+		return next, true
+	}
+	return 0, false
+}
+
+// Returns the 8.3 name of the given directory entry, e.g. "README.TXT"
+func shortName(entry []byte) string {
+	name := []byte(strings.TrimRight(string(entry[0:8]), " "))
+	if len(name) > 0 && name[0] == 0x05 {
+		// 0xe5 is a valid first character, but stored as 0x05 so the entry isn't taken as deleted
+		name[0] = entryDeleted
+	}
+	extension := strings.TrimRight(string(entry[8:11]), " ")
+	if extension == "" {
+		return string(name)
+	}
+	return fmt.Sprintf("%s.%s", name, extension)
+}
+
+// Returns the checksum of the 8.3 name of the given directory entry, as stored in its long file name entries
+func shortNameChecksum(entry []byte) byte {
+	var sum byte
+	for _, c := range entry[0:11] {
+		sum = (sum&1)<<7 + sum>>1 + c
+	}
+	return sum
+}
+
+// Decodes a long file name, which is UTF-16 terminated by a null character and padded with 0xffff
+func decodeLongName(name []uint16) string {
+	for i, c := range name {
+		if c == 0 || c == 0xffff {
+			name = name[:i]
+			break
+		}
+	}
+	return string(utf16.Decode(name))
+}
@@ -0,0 +1,157 @@
+package usbstorage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// Layout of the FAT16 file system built by fatDisk, in sectors of 512 bytes
+const (
+	testFatSector   = 1
+	testRootSector  = 21
+	testDataSector  = 22
+	testTotalSector = 5000
+)
+
+// Returns a directory entry with the given 8.3 name, attributes, first cluster and size
+func directoryEntry(name string, attributes byte, cluster uint16, size uint32) []byte {
+	entry := make([]byte, 32)
+	copy(entry[0:11], name)
+	entry[11] = attributes
+	binary.LittleEndian.PutUint16(entry[26:28], cluster)
+	binary.LittleEndian.PutUint32(entry[28:32], size)
+	return entry
+}
+
+// Returns the sector holding the given cluster
+func clusterSector(cluster uint16) uint64 {
+	return testDataSector + uint64(cluster) - 2
+}
+
+// Returns a disk holding a FAT16 file system without partition table, with one sector per cluster.
+// HELLO.TXT is complete and fragmented, the data of DIR/A.BIN was never seen, HUGE.BIN claims to be 4 GiB
+// without being listed in the FAT, and COPY.TXT was written by the host. Also returns the content of HELLO.TXT.
+func fatDisk() (*disk, []byte) {
+	d := newDisk()
+
+	boot := make([]byte, 512)
+	binary.LittleEndian.PutUint16(boot[11:13], 512)
+	boot[13] = 1
+	binary.LittleEndian.PutUint16(boot[14:16], testFatSector)
+	boot[16] = 1
+	binary.LittleEndian.PutUint16(boot[17:19], 16)
+	binary.LittleEndian.PutUint16(boot[19:21], testTotalSector)
+	binary.LittleEndian.PutUint16(boot[22:24], testRootSector-testFatSector)
+	boot[510], boot[511] = 0x55, 0xaa
+	d.store(0, boot, false)
+
+	fat := make([]byte, 512)
+	for cluster, next := range map[int]uint16{2: 5, 5: 0xffff, 6: 0xffff, 7: 0xffff, 8: 0xffff} {
+		binary.LittleEndian.PutUint16(fat[2*cluster:], next)
+	}
+	d.store(testFatSector, fat, false)
+
+	root := bytes.Join([][]byte{
+		directoryEntry("HELLO   TXT", 0, 2, 700),
+		directoryEntry("DIR        ", attributeDirectory, 6, 0),
+		directoryEntry("HUGE    BIN", 0, 100, 0xffffffff),
+		directoryEntry("COPY    TXT", 0, 8, 10),
+	}, nil)
+	d.store(testRootSector, append(root, make([]byte, 512-len(root))...), false)
+
+	subdirectory := bytes.Join([][]byte{
+		directoryEntry(".          ", attributeDirectory, 6, 0),
+		directoryEntry("..         ", attributeDirectory, 0, 0),
+		directoryEntry("A       BIN", 0, 7, 100),
+	}, nil)
+	d.store(clusterSector(6), append(subdirectory, make([]byte, 512-len(subdirectory))...), false)
+
+	hello := bytes.Repeat([]byte("hello, world"), 59)[:700]
+	d.store(clusterSector(2), hello[:512], false)
+	d.store(clusterSector(3), bytes.Repeat([]byte{0xff}, 512), false)
+	d.store(clusterSector(5), append(hello[512:], make([]byte, 1024-700)...), false)
+	d.store(clusterSector(8), append([]byte("copied off"), make([]byte, 502)...), true)
+	d.store(clusterSector(100), make([]byte, 1024), false)
+	return d, hello
+}
+
+func TestCarve(t *testing.T) {
+	d, hello := fatDisk()
+	kind, files := carve(d)
+	if kind != "FAT16" {
+		t.Fatalf("got file system '%s', expected FAT16", kind)
+	}
+
+	expected := []struct {
+		path     string
+		size     int
+		present  int
+		written  bool
+		complete bool
+	}{
+		{"HELLO.TXT", 700, 700, false, true},
+		{"DIR/A.BIN", 100, 0, false, false},
+		{"HUGE.BIN", (testTotalSector - testDataSector) * 512, 1024, false, false},
+		{"COPY.TXT", 10, 10, true, true},
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("got %d files, expected %d", len(files), len(expected))
+	}
+	for i, e := range expected {
+		f := files[i]
+		if f.path != e.path || f.size != e.size || f.present != e.present || f.written != e.written || f.complete() != e.complete {
+			t.Errorf("file %d: got %s of %d bytes, %d seen, written %t, complete %t, expected %s of %d bytes, %d seen, written %t, complete %t",
+				i, f.path, f.size, f.present, f.written, f.complete(), e.path, e.size, e.present, e.written, e.complete)
+		}
+	}
+
+	// The data of complete files follows the FAT
+	if data := files[0].read(); !bytes.Equal(data, hello) {
+		t.Errorf("got %q for HELLO.TXT, expected %q", data, hello)
+	}
+	if data := files[3].read(); string(data) != "copied off" {
+		t.Errorf("got %q for COPY.TXT, expected \"copied off\"", data)
+	}
+}
+
+func TestReadBack(t *testing.T) {
+	// The host reads back the block of COPY.TXT it wrote before
+	d, _ := fatDisk()
+	d.store(clusterSector(8), append([]byte("copied off"), make([]byte, 502)...), false)
+
+	_, files := carve(d)
+	if len(files) != 4 || files[3].path != "COPY.TXT" || !files[3].written {
+		t.Errorf("got %d files, expected COPY.TXT to stay written by the host after reading it back", len(files))
+	}
+}
+
+func TestCarvePartition(t *testing.T) {
+	// Move the file system to a partition starting at block 2048
+	plain, hello := fatDisk()
+	d := newDisk()
+	for address, block := range plain.blocks {
+		d.store(2048+address, block, plain.written[address])
+	}
+	mbr := make([]byte, 512)
+	mbr[446+4] = 0x06
+	binary.LittleEndian.PutUint32(mbr[446+8:], 2048)
+	mbr[510], mbr[511] = 0x55, 0xaa
+	d.store(0, mbr, false)
+
+	kind, files := carve(d)
+	if kind != "FAT16 in partition 1" {
+		t.Fatalf("got file system '%s', expected FAT16 in partition 1", kind)
+	}
+	if len(files) != 4 || !bytes.Equal(files[0].read(), hello) {
+		t.Errorf("got %d files, expected HELLO.TXT to be recovered from the partition", len(files))
+	}
+}
+
+func TestNoFilesystem(t *testing.T) {
+	d := newDisk()
+	d.store(0, make([]byte, 4096), false)
+	if kind, files := carve(d); kind != "" || len(files) != 0 {
+		t.Errorf("got file system '%s' with %d files on an empty disk", kind, len(files))
+	}
+}
@@ -0,0 +1,336 @@
+package usbstorage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/protocol"
+	"github.com/maride/pancap/usb"
+)
+
+const (
+	// Bulk-Only Transport wraps each SCSI command into a Command Block Wrapper, and ends it with a Command Status Wrapper
+	cbwSignature = "USBC"
+	cbwLength    = 31
+	cswSignature = "USBS"
+	cswLength    = 13
+
+	// SCSI commands of interest
+	scsiInquiry           = 0x12
+	scsiReadCapacity10    = 0x25
+	scsiRead10            = 0x28
+	scsiWrite10           = 0x2a
+	scsiRead16            = 0x88
+	scsiWrite16           = 0x8a
+	scsiServiceActionIn   = 0x9e
+	scsiRead12            = 0xa8
+	scsiWrite12           = 0xaa
+	serviceReadCapacity16 = 0x10
+)
+
+type Protocol struct {
+	files   *output.FileManager
+	devices map[string]*device
+}
+
+// A single mass storage device, identified by its bus and device number
+type device struct {
+	id      string
+	vendor  string
+	product string
+	// Command currently in progress, if any
+	command *command
+	// Disks of the device by their logical unit number
+	disks map[uint8]*disk
+}
+
+// A SCSI command in progress, and the data transferred so far
+type command struct {
+	tag    uint32
+	lun    uint8
+	in     bool
+	length int
+	block  []byte
+	data   []byte
+}
+
+func init() {
+	protocol.Register(protocol.Module{
+		Name:        "usbstorage",
+		Description: "Recovers disk images and files read from or written to USB mass storage devices",
+		Enabled:     true,
+		New: func(ctx *protocol.Context) protocol.Protocol {
+			return New(ctx.Files)
+		},
+	})
+}
+
+// Creates a new USB mass storage module, registering the disk images and recovered files with the given file manager
+func New(files *output.FileManager) *Protocol {
+	return &Protocol{
+		files:   files,
+		devices: make(map[string]*device),
+	}
+}
+
+// Checks if the given packet carries data of a bulk transfer
+func (p *Protocol) CanAnalyze(packet gopacket.Packet) bool {
+	transfer, ok := usb.Decode(packet)
+	return ok && transfer.Type == usb.TransferBulk && len(transfer.Data) > 0
+}
+
+// Follows the Bulk-Only Transport of the given transfer, storing the data of completed reads and writes
+func (p *Protocol) Analyze(packet gopacket.Packet) error {
+	transfer, ok := usb.Decode(packet)
+	if !ok || transfer.Type != usb.TransferBulk || len(transfer.Data) == 0 {
+		return nil
+	}
+
+	d, found := p.devices[transfer.DeviceID()]
+	if !found {
+		d = &device{id: transfer.DeviceID(), disks: make(map[uint8]*disk)}
+		p.devices[d.id] = d
+	}
+
+	c := d.command
+	switch {
+	case !transfer.In && !transfer.Completion:
+		// Data sent by the host is either data of a pending write, or the next command
+		if c != nil && !c.in && len(c.data) < c.length {
+			c.data = append(c.data, transfer.Data...)
+		} else if next, ok := parseCommand(transfer.Data); ok {
+			d.command = next
+		}
+	case transfer.In && transfer.Completion && c != nil:
+		// Data sent by the device is either the status of the pending command, or data of a pending read
+		if isStatus(transfer.Data, c.tag) {
+			d.command = nil
+			if transfer.Data[12] == 0 {
+				d.complete(c)
+			}
+		} else if c.in && len(c.data) < c.length {
+			c.data = append(c.data, transfer.Data...)
+		}
+	}
+
+	return nil
+}
+
+// Registers an image of each disk, and all files found on it
+func (p *Protocol) Finalize() error {
+	for _, d := range p.sortedDevices() {
+		for _, lun := range d.sortedLUNs() {
+			dsk := d.disks[lun]
+			if len(dsk.blocks) == 0 {
+				continue
+			}
+			origin := d.name(lun)
+
+			image, truncated := dsk.image()
+			dsk.truncated = truncated
+			p.files.RegisterFile(imageName(d, lun), image, fmt.Sprintf("Disk image of %s", origin))
+
+			// Only register complete files, missing parts would be filled with zeroes.
+			// Keep the memory used in check, as file sizes are taken from the disk.
+			dsk.filesystem, dsk.files = carve(dsk)
+			registered := 0
+			for i, f := range dsk.files {
+				if f.complete() && registered+f.size <= maxImageSize {
+					p.files.RegisterFile(f.path, f.read(), fmt.Sprintf("%s on %s", f.path, origin))
+					dsk.files[i].registered = true
+					registered += f.size
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns a block for each disk, sorted by device and logical unit
+func (p *Protocol) Summary() []output.Block {
+	var blocks []output.Block
+	for _, d := range p.sortedDevices() {
+		for _, lun := range d.sortedLUNs() {
+			blocks = append(blocks, d.summary(lun))
+		}
+	}
+
+	// Keep an empty block, so the module shows up if empty blocks are printed
+	if len(blocks) == 0 {
+		blocks = append(blocks, output.Block{Headline: "USB storage devices"})
+	}
+	return blocks
+}
+
+// Summarizes the given disk of the device
+func (d *device) summary(lun uint8) output.Block {
+	dsk := d.disks[lun]
+	block := output.Block{Headline: d.name(lun)}
+
+	if d.vendor != "" || d.product != "" {
+		block.Add(output.Property{Name: "Device", Value: strings.TrimSpace(d.vendor + " " + d.product)})
+	}
+	if dsk.capacity > 0 {
+		size := dsk.capacity * uint64(dsk.blockSize)
+		block.Add(output.Property{Name: "Capacity", Value: fmt.Sprintf("%d MiB (%d blocks of %d bytes)", size>>20, dsk.capacity, dsk.blockSize)})
+	}
+	block.Add(
+		output.Count{Name: "blocksRead", Value: dsk.blocksRead, Label: "blocks read"},
+		output.Count{Name: "blocksWritten", Value: dsk.blocksWritten, Label: "blocks written"},
+	)
+	if len(dsk.blocks) == 0 {
+		return block
+	}
+
+	// State where the disk image went, and if it's incomplete
+	line := fmt.Sprintf("Disk image of %d captured blocks registered as %s", len(dsk.blocks), imageName(d, lun))
+	if dsk.truncated {
+		line += fmt.Sprintf(", cut off at %d MiB", maxImageSize>>20)
+	}
+	block.Add(output.Text{Line: line})
+	if dsk.blocksDropped > 0 {
+		block.Add(output.Text{Line: fmt.Sprintf("%d blocks were dropped, as only %d MiB of blocks are kept", dsk.blocksDropped, maxImageSize>>20)})
+	}
+
+	if dsk.filesystem == "" {
+		block.Add(output.Text{Line: "No FAT file system found, inspect the disk image with other tools"})
+		return block
+	}
+	block.Add(output.Property{Name: "File system", Value: dsk.filesystem})
+
+	// List all files, and warn about files copied onto the device
+	table := output.Table{Title: "Files", Columns: []string{"Path", "Size", "Access", "Status"}}
+	written := 0
+	for _, f := range dsk.files {
+		access := "read"
+		if f.written {
+			access = "written"
+			written++
+		}
+		status := "recovered"
+		if !f.complete() {
+			status = fmt.Sprintf("incomplete, %d bytes seen", f.present)
+		} else if !f.registered {
+			status = fmt.Sprintf("complete, but not extracted beyond %d MiB of files", maxImageSize>>20)
+		}
+		table.Rows = append(table.Rows, []interface{}{f.path, f.size, access, status})
+	}
+	block.Add(table)
+	if written > 0 {
+		block.Add(output.Finding{
+			Severity: output.SeverityWarning,
+			Message:  fmt.Sprintf("Data was copied onto %s, %d of the files listed were written by the host", d.name(lun), written),
+		})
+	}
+	return block
+}
+
+// Applies the given command, which completed successfully
+func (d *device) complete(c *command) {
+	dsk, found := d.disks[c.lun]
+	if !found {
+		dsk = newDisk()
+		d.disks[c.lun] = dsk
+	}
+
+	switch c.block[0] {
+	case scsiInquiry:
+		if len(c.data) >= 32 {
+			d.vendor = strings.TrimSpace(string(c.data[8:16]))
+			d.product = strings.TrimSpace(string(c.data[16:32]))
+		}
+	case scsiReadCapacity10:
+		if len(c.data) >= 8 {
+			dsk.setCapacity(uint64(binary.BigEndian.Uint32(c.data[0:4])), binary.BigEndian.Uint32(c.data[4:8]))
+		}
+	case scsiServiceActionIn:
+		if len(c.block) >= 2 && c.block[1]&0x1f == serviceReadCapacity16 && len(c.data) >= 12 {
+			dsk.setCapacity(binary.BigEndian.Uint64(c.data[0:8]), binary.BigEndian.Uint32(c.data[8:12]))
+		}
+	case scsiRead10, scsiRead12, scsiRead16:
+		if address, ok := blockAddress(c.block); ok {
+			dsk.blocksRead += dsk.store(address, c.data, false)
+		}
+	case scsiWrite10, scsiWrite12, scsiWrite16:
+		if address, ok := blockAddress(c.block); ok {
+			dsk.blocksWritten += dsk.store(address, c.data, true)
+		}
+	}
+}
+
+// Returns the name of the given disk of the device, e.g. "USB storage 1.4"
+func (d *device) name(lun uint8) string {
+	if lun == 0 {
+		return fmt.Sprintf("USB storage %s", d.id)
+	}
+	return fmt.Sprintf("USB storage %s, LUN %d", d.id, lun)
+}
+
+// Returns the logical unit numbers of all disks of the device, sorted
+func (d *device) sortedLUNs() []uint8 {
+	var luns []uint8
+	for lun := range d.disks {
+		luns = append(luns, lun)
+	}
+	sort.Slice(luns, func(i, j int) bool {
+		return luns[i] < luns[j]
+	})
+	return luns
+}
+
+// Returns all devices, sorted by their ID
+func (p *Protocol) sortedDevices() []*device {
+	var devices []*device
+	for _, d := range p.devices {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].id < devices[j].id
+	})
+	return devices
+}
+
+// Returns the file name of the image of the given disk
+func imageName(d *device, lun uint8) string {
+	return fmt.Sprintf("usb-storage-%s-lun%d.img", d.id, lun)
+}
+
+// Parses the given Command Block Wrapper, returning false if the data isn't one
+func parseCommand(data []byte) (*command, bool) {
+	if len(data) != cbwLength || !bytes.HasPrefix(data, []byte(cbwSignature)) {
+		return nil, false
+	}
+	blockLength := int(data[14] & 0x1f)
+	if blockLength == 0 || blockLength > 16 {
+		return nil, false
+	}
+
+	return &command{
+		tag:    binary.LittleEndian.Uint32(data[4:8]),
+		length: int(binary.LittleEndian.Uint32(data[8:12])),
+		in:     data[12]&0x80 != 0,
+		lun:    data[13] & 0x0f,
+		block:  append([]byte(nil), data[15:15+blockLength]...),
+	}, true
+}
+
+// Checks if the given data is the Command Status Wrapper of the command with the given tag
+func isStatus(data []byte, tag uint32) bool {
+	return len(data) == cswLength && bytes.HasPrefix(data, []byte(cswSignature)) && binary.LittleEndian.Uint32(data[4:8]) == tag
+}
+
+// Returns the logical block address of the given READ or WRITE command
+func blockAddress(block []byte) (uint64, bool) {
+	switch {
+	case (block[0] == scsiRead16 || block[0] == scsiWrite16) && len(block) >= 10:
+		return binary.BigEndian.Uint64(block[2:10]), true
+	case block[0] != scsiRead16 && block[0] != scsiWrite16 && len(block) >= 6:
+		return uint64(binary.BigEndian.Uint32(block[2:6])), true
+	}
+	return 0, false
+}
@@ -0,0 +1,128 @@
+package wireless
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// Capability bit of beacons and probe responses stating that the network is encrypted
+	capabilityPrivacy = 0x0010
+
+	// Authentication and key management suites of the RSN element
+	akmIEEE8021X   = 1
+	akmPSK         = 2
+	akmFTIEEE8021X = 3
+	akmSAE         = 8
+)
+
+// Prefix of the vendor specific element announcing WPA, i.e. the Microsoft OUI followed by type 1
+var wpaElementPrefix = []byte{0x00, 0x50, 0xf2, 0x01}
+
+// Information elements of a management frame
+type elements struct {
+	ssid    string
+	hasSSID bool
+	channel int
+	rsn     []byte
+	wpa     bool
+}
+
+// Length of the fixed fields in front of the information elements of management frames
+var fixedFieldsLength = map[layers.Dot11Type]int{
+	layers.Dot11TypeMgmtBeacon:           12,
+	layers.Dot11TypeMgmtProbeResp:        12,
+	layers.Dot11TypeMgmtProbeReq:         0,
+	layers.Dot11TypeMgmtAssociationReq:   4,
+	layers.Dot11TypeMgmtReassociationReq: 10,
+}
+
+// Collects the information elements of interest from the given management frame.
+// gopacket doesn't decode the elements of all kinds of frames, so they are parsed here.
+func parseElements(frame *layers.Dot11) elements {
+	var e elements
+	data := frame.Payload
+	offset, ok := fixedFieldsLength[frame.Type]
+	if !ok || len(data) < offset {
+		return e
+	}
+
+	for data = data[offset:]; len(data) >= 2 && len(data) >= 2+int(data[1]); data = data[2+int(data[1]):] {
+		id, info := layers.Dot11InformationElementID(data[0]), data[2:2+int(data[1])]
+		switch id {
+		case layers.Dot11InformationElementIDSSID:
+			// Hidden networks send an empty SSID, or one consisting of null bytes only
+			if !e.hasSSID {
+				e.hasSSID = true
+				e.ssid = string(bytes.TrimRight(info, "\x00"))
+			}
+		case layers.Dot11InformationElementIDDSSet:
+			if len(info) == 1 {
+				e.channel = int(info[0])
+			}
+		case layers.Dot11InformationElementIDRSNInfo:
+			e.rsn = info
+		case layers.Dot11InformationElementIDVendor:
+			e.wpa = e.wpa || bytes.HasPrefix(info, wpaElementPrefix)
+		}
+	}
+	return e
+}
+
+// Returns the encryption announced by a network with the given capabilities, e.g. "WPA2-PSK"
+func (e elements) encryption(capabilities uint16) string {
+	switch {
+	case e.rsn != nil:
+		return rsnEncryption(e.rsn)
+	case e.wpa:
+		return "WPA"
+	case capabilities&capabilityPrivacy != 0:
+		return "WEP"
+	}
+	return "open"
+}
+
+// Returns the encryption announced by the given RSN element, depending on its authentication suites
+func rsnEncryption(rsn []byte) string {
+	// The RSN element starts with its version and the group cipher suite, followed by the list of pairwise cipher
+	// suites and the list of authentication suites. Each list starts with its length.
+	if len(rsn) < 8 {
+		return "WPA2"
+	}
+	offset := 8 + 4*int(binary.LittleEndian.Uint16(rsn[6:8]))
+	if len(rsn) < offset+2 {
+		return "WPA2"
+	}
+	count := int(binary.LittleEndian.Uint16(rsn[offset : offset+2]))
+	offset += 2
+
+	encryption := "WPA2"
+	for i := 0; i < count && len(rsn) >= offset+4*(i+1); i++ {
+		switch rsn[offset+4*i+3] {
+		case akmSAE:
+			return "WPA3-SAE"
+		case akmPSK:
+			encryption = "WPA2-PSK"
+		case akmIEEE8021X, akmFTIEEE8021X:
+			encryption = "WPA2-Enterprise"
+		}
+	}
+	return encryption
+}
+
+// Returns the channel of the given frequency in MHz, or 0 if it doesn't belong to a known band
+func channelOf(frequency int) int {
+	switch {
+	case frequency == 2484:
+		return 14
+	case frequency >= 2412 && frequency <= 2472:
+		return (frequency - 2407) / 5
+	case frequency >= 5160 && frequency <= 5885:
+		return (frequency - 5000) / 5
+	case frequency >= 5955 && frequency <= 7115:
+		return (frequency - 5950) / 5
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package wireless
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maride/pancap/output"
+)
+
+const (
+	// A network receiving this many deauthentication or disassociation frames within the window is considered flooded.
+	// Clients leaving a network send a single frame, tools like aireplay-ng send dozens of them per second.
+	floodThreshold = 20
+	floodWindow    = 10 * time.Second
+)
+
+// Deauthentication or disassociation frames sent in the name of a single network
+type flood struct {
+	kind    string
+	bssid   string
+	frames  int
+	targets map[string]bool
+
+	// Timestamps of the frames within the window, and the most frames seen within a window
+	window []time.Time
+	peak   int
+	// File the flood was detected in
+	origin string
+}
+
+// Counts a frame sent at the given time to the given target
+func (f *flood) add(timestamp time.Time, target string, origin string) {
+	f.frames++
+	f.targets[target] = true
+
+	// Drop the frames which left the window
+	f.window = append(f.window, timestamp)
+	for len(f.window) > 0 && timestamp.Sub(f.window[0]) > floodWindow {
+		f.window = f.window[1:]
+	}
+
+	if len(f.window) > f.peak {
+		f.peak = len(f.window)
+		if f.peak == floodThreshold {
+			f.origin = origin
+		}
+	}
+}
+
+// Returns a finding if the frames qualify as flood
+func (f *flood) finding(ssid string) (output.Finding, bool) {
+	if f.peak < floodThreshold {
+		return output.Finding{}, false
+	}
+
+	var targets []string
+	for t := range f.targets {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+
+	network := f.bssid
+	if ssid != "" {
+		network = fmt.Sprintf("%s (%s)", f.bssid, ssid)
+	}
+	return output.Finding{
+		Severity: output.SeverityWarning,
+		Message: fmt.Sprintf("Possible %s flood against %s: %d frames, up to %d within %s, sent to %s",
+			f.kind, network, f.frames, f.peak, floodWindow, strings.Join(targets, ", ")),
+		Source: f.origin,
+	}, true
+}
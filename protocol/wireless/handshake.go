@@ -0,0 +1,269 @@
+package wireless
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/output"
+)
+
+const (
+	// Key information bits of an EAPOL-Key frame
+	keyInfoPairwise = 0x0008
+	keyInfoInstall  = 0x0040
+	keyInfoAck      = 0x0080
+	keyInfoMIC      = 0x0100
+	keyInfoSecure   = 0x0200
+
+	// Offsets of the fields of an EAPOL-Key frame, including the EAPOL header
+	keyInfoOffset       = 5
+	keyReplayOffset     = 9
+	keyNonceOffset      = 17
+	keyMICOffset        = 81
+	keyDataLengthOffset = 97
+	keyDataOffset       = 99
+
+	// Message pairs of the hashcat 22000 format, stating which messages the nonce and the EAPOL frame come from
+	pairM1M2            = 0x00
+	pairM1M4            = 0x01
+	pairM2M3            = 0x02
+	pairM3M4            = 0x05
+	pairReplayUnchecked = 0x80
+
+	// Name of the file holding the hashes
+	hashFileName = "wpa.22000"
+)
+
+// Key data element carrying the PMKID, i.e. a vendor specific element with the IEEE OUI and type 4
+var pmkidPrefix = []byte{0xdd, 0x14, 0x00, 0x0f, 0xac, 0x04}
+
+// The EAPOL messages exchanged between a network and a client
+type handshake struct {
+	bssid  string
+	client string
+	// Latest EAPOL-Key frame of each message of the 4-way handshake, indexed by message number
+	messages [5]*keyMessage
+	pmkids   [][]byte
+}
+
+// A single EAPOL-Key frame
+type keyMessage struct {
+	replay uint64
+	nonce  []byte
+	mic    []byte
+	// The whole EAPOL frame, with the MIC zeroed out
+	frame []byte
+}
+
+// Notes the EAPOL-Key frame carried by the given frame as part of a handshake
+func (p *Protocol) analyzeHandshake(frame *layers.Dot11, eapol *layers.EAPOL) {
+	data := append(append([]byte(nil), eapol.LayerContents()...), eapol.LayerPayload()...)
+	if eapol.Type != layers.EAPOLTypeKey || len(data) < keyDataOffset || len(data) < 4+int(eapol.Length) {
+		return
+	}
+	data = data[:4+int(eapol.Length)]
+
+	info := binary.BigEndian.Uint16(data[keyInfoOffset : keyInfoOffset+2])
+	if info&keyInfoPairwise == 0 {
+		// Group key handshakes don't help with the passphrase
+		return
+	}
+
+	// Tell the messages apart by their key information. WPA1 doesn't set the secure bit in message 4,
+	// so messages 2 and 4 are told apart by the nonce, which only message 2 needs to carry.
+	nonce := data[keyNonceOffset : keyNonceOffset+32]
+	var message int
+	switch {
+	case info&keyInfoAck != 0 && info&keyInfoMIC == 0:
+		message = 1
+	case info&keyInfoAck != 0 && info&keyInfoInstall != 0:
+		message = 3
+	case info&keyInfoAck == 0 && info&keyInfoMIC != 0 && info&keyInfoSecure == 0 && !isZero(nonce):
+		message = 2
+	case info&keyInfoAck == 0 && info&keyInfoMIC != 0:
+		message = 4
+	default:
+		return
+	}
+
+	// Messages 1 and 3 are sent by the access point, 2 and 4 by the client
+	bssid, client := frame.Address2.String(), frame.Address1.String()
+	if message%2 == 0 {
+		bssid, client = client, bssid
+	}
+	h, found := p.handshakes[bssid+client]
+	if !found {
+		h = &handshake{bssid: bssid, client: client}
+		p.handshakes[bssid+client] = h
+	}
+
+	m := &keyMessage{
+		replay: binary.BigEndian.Uint64(data[keyReplayOffset : keyReplayOffset+8]),
+		nonce:  append([]byte(nil), nonce...),
+		mic:    append([]byte(nil), data[keyMICOffset:keyMICOffset+16]...),
+		frame:  data,
+	}
+	copy(m.frame[keyMICOffset:keyMICOffset+16], make([]byte, 16))
+	h.messages[message] = m
+
+	// The first message may carry the PMKID in its key data
+	if message == 1 {
+		keyData := data[keyDataOffset:]
+		if length := int(binary.BigEndian.Uint16(data[keyDataLengthOffset:keyDataOffset])); length < len(keyData) {
+			keyData = keyData[:length]
+		}
+		if i := bytes.Index(keyData, pmkidPrefix); i >= 0 && len(keyData) >= i+len(pmkidPrefix)+16 {
+			h.addPMKID(keyData[i+len(pmkidPrefix) : i+len(pmkidPrefix)+16])
+		}
+	}
+}
+
+// Registers the hashes of all handshakes and PMKIDs with a known SSID in hashcat's 22000 format
+func (p *Protocol) Finalize() error {
+	var lines []string
+	for _, h := range p.sortedHandshakes() {
+		lines = append(lines, h.hashes(p.ssidOf(h.bssid))...)
+	}
+	if len(lines) > 0 {
+		p.files.RegisterFile(hashFileName, []byte(strings.Join(lines, "\n")+"\n"), "WPA handshakes and PMKIDs, for hashcat -m 22000")
+	}
+	return nil
+}
+
+// Generates an overview of all handshakes
+func (p *Protocol) generateHandshakes() output.Block {
+	table := output.Table{Columns: []string{"BSSID", "SSID", "Client", "Messages", "PMKID", "Hashes"}}
+	hashes := 0
+	for _, h := range p.sortedHandshakes() {
+		var messages []string
+		for i, m := range h.messages {
+			if m != nil {
+				messages = append(messages, fmt.Sprintf("M%d", i))
+			}
+		}
+		pmkid := ""
+		if len(h.pmkids) > 0 {
+			pmkid = "found"
+		}
+
+		// Hashes can't be cracked without the SSID, as it salts the key
+		ssid := p.ssidOf(h.bssid)
+		n := len(h.hashes(ssid))
+		count := fmt.Sprintf("%d", n)
+		if ssid == "" && (len(h.pmkids) > 0 || h.eapolHash(ssid) != "") {
+			count = "SSID unknown"
+		}
+		hashes += n
+
+		table.Rows = append(table.Rows, []interface{}{h.bssid, ssidName(ssid), h.client, strings.Join(messages, ", "), pmkid, count})
+	}
+
+	block := output.Block{Headline: "WPA handshakes"}
+	if len(table.Rows) == 0 {
+		return block
+	}
+	block.Add(table)
+	if hashes > 0 {
+		block.Add(output.Text{Line: fmt.Sprintf("%d hashes registered as %s, extract them with -extract-all and crack them with hashcat -m 22000", hashes, hashFileName)})
+	}
+	return block
+}
+
+// Returns the lines of hashcat's 22000 format for the PMKIDs and the 4-way handshake, if the SSID is known
+func (h *handshake) hashes(ssid string) []string {
+	if ssid == "" {
+		return nil
+	}
+
+	var lines []string
+	for _, pmkid := range h.pmkids {
+		lines = append(lines, fmt.Sprintf("WPA*01*%x*%s*%s*%x***", pmkid, hexAddress(h.bssid), hexAddress(h.client), ssid))
+	}
+	if line := h.eapolHash(ssid); line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Returns the line of hashcat's 22000 format for the 4-way handshake, or an empty string if it is too incomplete.
+// The EAPOL frame of the client is combined with the nonce of the access point, preferring messages with matching
+// replay counters - otherwise, hashcat is told that the replay counters weren't checked.
+func (h *handshake) eapolHash(ssid string) string {
+	m := h.messages
+	var eapol, nonce *keyMessage
+	var pair int
+
+	switch {
+	case m[2] != nil && m[1] != nil && m[1].replay == m[2].replay:
+		eapol, nonce, pair = m[2], m[1], pairM1M2
+	case m[2] != nil && m[3] != nil && m[3].replay == m[2].replay+1:
+		eapol, nonce, pair = m[2], m[3], pairM2M3
+	case m[2] != nil && m[1] != nil:
+		eapol, nonce, pair = m[2], m[1], pairM1M2|pairReplayUnchecked
+	case m[2] != nil && m[3] != nil:
+		eapol, nonce, pair = m[2], m[3], pairM2M3|pairReplayUnchecked
+	case m[4] != nil && m[3] != nil && !isZero(m[4].nonce):
+		eapol, nonce, pair = m[4], m[3], pairM3M4
+	case m[4] != nil && m[1] != nil && !isZero(m[4].nonce):
+		eapol, nonce, pair = m[4], m[1], pairM1M4|pairReplayUnchecked
+	default:
+		return ""
+	}
+
+	return fmt.Sprintf("WPA*02*%x*%s*%s*%x*%x*%x*%02x", eapol.mic, hexAddress(h.bssid), hexAddress(h.client), ssid, nonce.nonce, eapol.frame, pair)
+}
+
+// Adds the given PMKID, if it's new and not all zeroes
+func (h *handshake) addPMKID(pmkid []byte) {
+	if isZero(pmkid) {
+		return
+	}
+	for _, known := range h.pmkids {
+		if bytes.Equal(known, pmkid) {
+			return
+		}
+	}
+	h.pmkids = append(h.pmkids, append([]byte(nil), pmkid...))
+}
+
+// Returns all handshakes, sorted by network and client
+func (p *Protocol) sortedHandshakes() []*handshake {
+	var handshakes []*handshake
+	for _, h := range p.handshakes {
+		handshakes = append(handshakes, h)
+	}
+	sort.Slice(handshakes, func(i, j int) bool {
+		if handshakes[i].bssid != handshakes[j].bssid {
+			return handshakes[i].bssid < handshakes[j].bssid
+		}
+		return handshakes[i].client < handshakes[j].client
+	})
+	return handshakes
+}
+
+// Returns the SSID of the network with the given BSSID, or an empty string if unknown
+func (p *Protocol) ssidOf(bssid string) string {
+	if n, found := p.networks[bssid]; found {
+		return n.ssid
+	}
+	return ""
+}
+
+// Returns the given MAC address as plain hex string, as used by hashcat
+func hexAddress(address string) string {
+	return strings.Replace(address, ":", "", -1)
+}
+
+// Checks if the given data consists of null bytes only
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package wireless
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	testBSSID  = net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	testClient = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+)
+
+// Returns an EAPOL-Key frame with the given key information, replay counter, nonce, MIC and key data
+func keyFrame(info uint16, replay uint64, nonce, mic, keyData []byte) []byte {
+	data := make([]byte, keyDataOffset+len(keyData))
+	data[0], data[1] = 2, byte(layers.EAPOLTypeKey)
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)-4))
+	data[4] = 2
+	binary.BigEndian.PutUint16(data[keyInfoOffset:], info|keyInfoPairwise|0x0002)
+	binary.BigEndian.PutUint64(data[keyReplayOffset:], replay)
+	copy(data[keyNonceOffset:], nonce)
+	copy(data[keyMICOffset:], mic)
+	binary.BigEndian.PutUint16(data[keyDataLengthOffset:], uint16(len(keyData)))
+	copy(data[keyDataOffset:], keyData)
+	return data
+}
+
+// Hands the given EAPOL-Key frame to the module, sent by the access point if fromAP is set, by the client otherwise
+func addKeyFrame(t *testing.T, p *Protocol, data []byte, fromAP bool) {
+	eapol, ok := gopacket.NewPacket(data, layers.LayerTypeEAPOL, gopacket.Default).Layer(layers.LayerTypeEAPOL).(*layers.EAPOL)
+	if !ok {
+		t.Fatalf("EAPOL frame %x doesn't decode", data)
+	}
+	frame := &layers.Dot11{Address1: testBSSID, Address2: testClient}
+	if fromAP {
+		frame.Address1, frame.Address2 = testClient, testBSSID
+	}
+	p.analyzeHandshake(frame, eapol)
+}
+
+// Returns the handshake seen by the module, failing unless there is exactly one
+func onlyHandshake(t *testing.T, p *Protocol) *handshake {
+	handshakes := p.sortedHandshakes()
+	if len(handshakes) != 1 {
+		t.Fatalf("got %d handshakes, expected 1", len(handshakes))
+	}
+	return handshakes[0]
+}
+
+func TestHashLines(t *testing.T) {
+	anonce := bytes.Repeat([]byte{0xa1}, 32)
+	snonce := bytes.Repeat([]byte{0xb2}, 32)
+	mic := bytes.Repeat([]byte{0xc3}, 16)
+	pmkid := bytes.Repeat([]byte{0xd4}, 16)
+
+	p := New(nil)
+	m1 := keyFrame(keyInfoAck, 1, anonce, nil, append(append([]byte(nil), pmkidPrefix...), pmkid...))
+	m2 := keyFrame(keyInfoMIC, 1, snonce, mic, []byte{0x30, 0x00})
+	addKeyFrame(t, p, m1, true)
+	addKeyFrame(t, p, m2, false)
+	addKeyFrame(t, p, keyFrame(keyInfoAck|keyInfoMIC|keyInfoInstall|keyInfoSecure, 2, anonce, mic, nil), true)
+	addKeyFrame(t, p, keyFrame(keyInfoMIC|keyInfoSecure, 2, nil, mic, nil), false)
+
+	h := onlyHandshake(t, p)
+	for i := 1; i <= 4; i++ {
+		if h.messages[i] == nil {
+			t.Errorf("message %d missing", i)
+		}
+	}
+	if lines := h.hashes(""); len(lines) != 0 {
+		t.Errorf("got %v without SSID, expected no lines", lines)
+	}
+
+	lines := h.hashes("CorpWiFi")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, expected a PMKID and an EAPOL line", len(lines))
+	}
+	ssid := hex.EncodeToString([]byte("CorpWiFi"))
+	if expected := "WPA*01*" + hex.EncodeToString(pmkid) + "*001122334455*aabbccddee01*" + ssid + "***"; lines[0] != expected {
+		t.Errorf("got PMKID line %s, expected %s", lines[0], expected)
+	}
+
+	// The EAPOL frame of message 2 is given with the MIC zeroed out, along with the nonce of message 1
+	zeroed := append([]byte(nil), m2...)
+	copy(zeroed[keyMICOffset:keyMICOffset+16], make([]byte, 16))
+	fields := strings.Split(lines[1], "*")
+	expected := []string{"WPA", "02", hex.EncodeToString(mic), "001122334455", "aabbccddee01", ssid,
+		hex.EncodeToString(anonce), hex.EncodeToString(zeroed), "00"}
+	if len(fields) != len(expected) {
+		t.Fatalf("got EAPOL line %s, expected %d fields", lines[1], len(expected))
+	}
+	for i := range expected {
+		if fields[i] != expected[i] {
+			t.Errorf("field %d of EAPOL line: got %s, expected %s", i, fields[i], expected[i])
+		}
+	}
+}
+
+func TestHashPairs(t *testing.T) {
+	anonce := bytes.Repeat([]byte{0xa1}, 32)
+	snonce := bytes.Repeat([]byte{0xb2}, 32)
+	mic := bytes.Repeat([]byte{0xc3}, 16)
+
+	m1 := func(replay uint64) []byte { return keyFrame(keyInfoAck, replay, anonce, nil, nil) }
+	m2 := func(replay uint64) []byte { return keyFrame(keyInfoMIC, replay, snonce, mic, nil) }
+	m3 := func(replay uint64) []byte {
+		return keyFrame(keyInfoAck|keyInfoMIC|keyInfoInstall|keyInfoSecure, replay, anonce, mic, nil)
+	}
+	// WPA1 doesn't set the secure bit in message 4, which carries no nonce
+	wpa1M4 := func(replay uint64) []byte { return keyFrame(keyInfoMIC, replay, nil, mic, nil) }
+	m4WithNonce := func(replay uint64) []byte { return keyFrame(keyInfoMIC|keyInfoSecure, replay, snonce, mic, nil) }
+
+	tests := []struct {
+		frames [][]byte
+		fromAP []bool
+		// Messages seen, and the pair stated in the EAPOL line, empty if there is none
+		messages []int
+		pair     string
+	}{
+		{[][]byte{m1(1), m2(1)}, []bool{true, false}, []int{1, 2}, "00"},
+		{[][]byte{m1(1), m2(5)}, []bool{true, false}, []int{1, 2}, "80"},
+		{[][]byte{m2(1), m3(2)}, []bool{false, true}, []int{2, 3}, "02"},
+		{[][]byte{m2(1), m3(7)}, []bool{false, true}, []int{2, 3}, "82"},
+		{[][]byte{m3(2), m4WithNonce(2)}, []bool{true, false}, []int{3, 4}, "05"},
+		{[][]byte{m1(1), m4WithNonce(2)}, []bool{true, false}, []int{1, 4}, "81"},
+		{[][]byte{m3(2), wpa1M4(2)}, []bool{true, false}, []int{3, 4}, ""},
+		{[][]byte{m2(1)}, []bool{false}, []int{2}, ""},
+	}
+
+	for i, test := range tests {
+		p := New(nil)
+		for j, frame := range test.frames {
+			addKeyFrame(t, p, frame, test.fromAP[j])
+		}
+		h := onlyHandshake(t, p)
+
+		var messages []int
+		for m := range h.messages {
+			if h.messages[m] != nil {
+				messages = append(messages, m)
+			}
+		}
+		if len(messages) != len(test.messages) {
+			t.Errorf("test %d: got messages %v, expected %v", i, messages, test.messages)
+			continue
+		}
+		for j := range messages {
+			if messages[j] != test.messages[j] {
+				t.Errorf("test %d: got messages %v, expected %v", i, messages, test.messages)
+				break
+			}
+		}
+
+		pair := ""
+		if line := h.eapolHash("CorpWiFi"); line != "" {
+			pair = line[strings.LastIndex(line, "*")+1:]
+		}
+		if pair != test.pair {
+			t.Errorf("test %d: got pair '%s', expected '%s'", i, pair, test.pair)
+		}
+	}
+}
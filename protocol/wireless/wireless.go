@@ -0,0 +1,405 @@
+package wireless
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/maride/pancap/capture"
+	"github.com/maride/pancap/output"
+	"github.com/maride/pancap/protocol"
+)
+
+type Protocol struct {
+	files        *output.FileManager
+	networks     map[string]*network
+	stations     map[string]*station
+	associations []*association
+	floods       map[string]*flood
+	handshakes   map[string]*handshake
+	// Strongest signal received from each transmitter, in dBm
+	signals map[string]int8
+}
+
+// A wireless network, identified by its BSSID
+type network struct {
+	bssid      string
+	ssid       string
+	channel    int
+	encryption string
+	beacons    int
+	clients    map[string]bool
+}
+
+// A client station, identified by its MAC address
+type station struct {
+	address string
+	// SSIDs the station asked for in directed probe requests
+	probes []string
+	// Probe requests not directed at a specific network
+	wildcardProbes int
+}
+
+// An attempt of a client to join a network
+type association struct {
+	client string
+	bssid  string
+	ssid   string
+	status string
+}
+
+func init() {
+	protocol.Register(protocol.Module{
+		Name:        "wireless",
+		Description: "Lists wireless networks, their clients and probe requests, detects deauthentication floods and extracts WPA handshakes",
+		Enabled:     true,
+		New: func(ctx *protocol.Context) protocol.Protocol {
+			return New(ctx.Files)
+		},
+	})
+}
+
+// Creates a new wireless module, registering the WPA hashes found with the given file manager
+func New(files *output.FileManager) *Protocol {
+	return &Protocol{
+		files:      files,
+		networks:   make(map[string]*network),
+		stations:   make(map[string]*station),
+		floods:     make(map[string]*flood),
+		handshakes: make(map[string]*handshake),
+		signals:    make(map[string]int8),
+	}
+}
+
+// Checks if the given packet is an 802.11 frame
+func (p *Protocol) CanAnalyze(packet gopacket.Packet) bool {
+	return packet.Layer(layers.LayerTypeDot11) != nil
+}
+
+// Analyzes the given 802.11 frame
+func (p *Protocol) Analyze(packet gopacket.Packet) error {
+	frame := packet.Layer(layers.LayerTypeDot11).(*layers.Dot11)
+
+	// Control frames don't tell much, and often don't even carry a transmitter address
+	if frame.Type.MainType() == layers.Dot11TypeCtrl || frame.Address2 == nil {
+		return nil
+	}
+	transmitter := frame.Address2.String()
+
+	// Note the signal strength and the channel, if the capture comes with a radiotap header
+	channel := 0
+	if radiotap, ok := packet.Layer(layers.LayerTypeRadioTap).(*layers.RadioTap); ok {
+		if radiotap.Present.DBMAntennaSignal() {
+			if strongest, found := p.signals[transmitter]; !found || radiotap.DBMAntennaSignal > strongest {
+				p.signals[transmitter] = radiotap.DBMAntennaSignal
+			}
+		}
+		if radiotap.Present.Channel() {
+			channel = channelOf(int(radiotap.ChannelFrequency))
+		}
+	}
+
+	switch frame.Type {
+	case layers.Dot11TypeMgmtBeacon, layers.Dot11TypeMgmtProbeResp:
+		p.analyzeBeacon(frame, channel)
+	case layers.Dot11TypeMgmtProbeReq:
+		p.analyzeProbe(frame, transmitter)
+	case layers.Dot11TypeMgmtAssociationReq, layers.Dot11TypeMgmtReassociationReq:
+		p.analyzeAssociationRequest(frame, transmitter)
+	case layers.Dot11TypeMgmtAssociationResp, layers.Dot11TypeMgmtReassociationResp:
+		p.analyzeAssociationResponse(frame)
+	case layers.Dot11TypeMgmtDeauthentication, layers.Dot11TypeMgmtDisassociation:
+		p.analyzeDeauthentication(packet, frame)
+	default:
+		if frame.Type.MainType() == layers.Dot11TypeData {
+			p.analyzeData(frame)
+			if eapol, ok := packet.Layer(layers.LayerTypeEAPOL).(*layers.EAPOL); ok {
+				p.analyzeHandshake(frame, eapol)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns blocks listing the networks, their clients and the handshakes found
+func (p *Protocol) Summary() []output.Block {
+	return []output.Block{
+		p.generateNetworks(),
+		p.generateClients(),
+		p.generateHandshakes(),
+	}
+}
+
+// Collects the network announced by the given beacon or probe response
+func (p *Protocol) analyzeBeacon(frame *layers.Dot11, channel int) {
+	n := p.getNetwork(frame.Address3.String())
+	e := parseElements(frame)
+
+	// Hidden networks may give away their SSID in probe responses
+	if e.ssid != "" {
+		n.ssid = e.ssid
+	}
+	if e.channel != 0 {
+		channel = e.channel
+	}
+	if channel != 0 {
+		n.channel = channel
+	}
+
+	if frame.Type == layers.Dot11TypeMgmtBeacon {
+		n.beacons++
+	}
+
+	// The capabilities follow the timestamp and the beacon interval
+	if len(frame.Payload) >= 12 {
+		n.encryption = e.encryption(binary.LittleEndian.Uint16(frame.Payload[10:12]))
+	}
+}
+
+// Notes the network the client asked for in the given probe request
+func (p *Protocol) analyzeProbe(frame *layers.Dot11, client string) {
+	s := p.getStation(client)
+	e := parseElements(frame)
+	if e.ssid == "" {
+		s.wildcardProbes++
+		return
+	}
+
+	for _, ssid := range s.probes {
+		if ssid == e.ssid {
+			return
+		}
+	}
+	s.probes = append(s.probes, e.ssid)
+}
+
+// Notes the network the client asks to join
+func (p *Protocol) analyzeAssociationRequest(frame *layers.Dot11, client string) {
+	bssid := frame.Address3.String()
+	e := parseElements(frame)
+	p.associations = append(p.associations, &association{client: client, bssid: bssid, ssid: e.ssid, status: "requested"})
+	p.getStation(client)
+
+	// Clients name hidden networks when joining them
+	if n := p.getNetwork(bssid); n.ssid == "" {
+		n.ssid = e.ssid
+	}
+}
+
+// Notes the outcome of an association request
+func (p *Protocol) analyzeAssociationResponse(frame *layers.Dot11) {
+	client := frame.Address1.String()
+	bssid := frame.Address3.String()
+
+	// The status follows the capabilities
+	status := "answered"
+	if len(frame.Payload) >= 4 {
+		code := layers.Dot11Status(binary.LittleEndian.Uint16(frame.Payload[2:4]))
+		if code == layers.Dot11StatusSuccess {
+			status = "successful"
+			p.getNetwork(bssid).clients[client] = true
+		} else {
+			status = fmt.Sprintf("failed: %s", code)
+		}
+	}
+
+	// Complete the latest request, or note the response on its own if the request wasn't captured
+	for i := len(p.associations) - 1; i >= 0; i-- {
+		a := p.associations[i]
+		if a.client == client && a.bssid == bssid {
+			if a.status == "requested" {
+				a.status = status
+				return
+			}
+			break
+		}
+	}
+	p.associations = append(p.associations, &association{client: client, bssid: bssid, status: status})
+}
+
+// Counts the given deauthentication or disassociation frame, to detect floods
+func (p *Protocol) analyzeDeauthentication(packet gopacket.Packet, frame *layers.Dot11) {
+	kind := "deauthentication"
+	if frame.Type == layers.Dot11TypeMgmtDisassociation {
+		kind = "disassociation"
+	}
+	bssid := frame.Address3.String()
+
+	f, found := p.floods[kind+bssid]
+	if !found {
+		f = &flood{kind: kind, bssid: bssid, targets: make(map[string]bool)}
+		p.floods[kind+bssid] = f
+	}
+	f.add(packet.Metadata().Timestamp, addressName(frame.Address1), capture.Origin(packet))
+}
+
+// Notes the client of the network the given data frame is sent in
+func (p *Protocol) analyzeData(frame *layers.Dot11) {
+	var bssid, client net.HardwareAddr
+	switch {
+	case frame.Flags.ToDS() && !frame.Flags.FromDS():
+		bssid, client = frame.Address1, frame.Address2
+	case frame.Flags.FromDS() && !frame.Flags.ToDS():
+		bssid, client = frame.Address2, frame.Address1
+	default:
+		return
+	}
+
+	// Frames sent to groups don't name a client
+	if len(client) == 0 || client[0]&0x01 != 0 {
+		return
+	}
+	p.getNetwork(bssid.String()).clients[client.String()] = true
+	p.getStation(client.String())
+}
+
+// Generates an overview of all networks, along with the floods detected
+func (p *Protocol) generateNetworks() output.Block {
+	var bssids []string
+	for bssid := range p.networks {
+		bssids = append(bssids, bssid)
+	}
+	sort.Strings(bssids)
+
+	table := output.Table{Columns: []string{"BSSID", "SSID", "Channel", "Encryption", "Signal", "Beacons", "Clients"}}
+	for _, bssid := range bssids {
+		n := p.networks[bssid]
+		channel := ""
+		if n.channel != 0 {
+			channel = fmt.Sprintf("%d", n.channel)
+		}
+		table.Rows = append(table.Rows, []interface{}{n.bssid, ssidName(n.ssid), channel, n.encryption, p.signal(n.bssid), n.beacons, len(n.clients)})
+	}
+
+	block := output.Block{Headline: "Wireless networks"}
+	if len(table.Rows) > 0 {
+		block.Add(table)
+	}
+
+	// Report floods, sorted by network
+	var keys []string
+	for key := range p.floods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f := p.floods[key]
+		ssid := ""
+		if n, found := p.networks[f.bssid]; found {
+			ssid = n.ssid
+		}
+		if finding, ok := f.finding(ssid); ok {
+			block.Add(finding)
+		}
+	}
+	return block
+}
+
+// Generates an overview of all clients, the networks they probed for, and their associations
+func (p *Protocol) generateClients() output.Block {
+	var addresses []string
+	for address := range p.stations {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	// Clients asking for networks by name give away where they have been before
+	clients := output.Table{Columns: []string{"Client", "Signal", "Networks", "Probed for"}}
+	leaking := 0
+	for _, address := range addresses {
+		s := p.stations[address]
+		probes := append([]string(nil), s.probes...)
+		if s.wildcardProbes > 0 {
+			probes = append(probes, "(any)")
+		}
+		if len(s.probes) > 0 {
+			leaking++
+		}
+		clients.Rows = append(clients.Rows, []interface{}{address, p.signal(address), strings.Join(p.networksOf(address), ", "), strings.Join(probes, ", ")})
+	}
+
+	associations := output.Table{Title: "Associations", Columns: []string{"Client", "BSSID", "SSID", "Status"}}
+	for _, a := range p.associations {
+		ssid := a.ssid
+		if n, found := p.networks[a.bssid]; found && ssid == "" {
+			ssid = n.ssid
+		}
+		associations.Rows = append(associations.Rows, []interface{}{a.client, a.bssid, ssid, a.status})
+	}
+
+	block := output.Block{Headline: "Wireless clients"}
+	if len(clients.Rows) > 0 {
+		block.Add(clients)
+	}
+	if len(associations.Rows) > 0 {
+		block.Add(associations)
+	}
+	if leaking > 0 {
+		block.Add(output.Finding{
+			Severity: output.SeverityInfo,
+			Message:  fmt.Sprintf("%d clients disclosed the names of networks they know in probe requests", leaking),
+		})
+	}
+	return block
+}
+
+// Returns the network with the given BSSID, or creates a new one
+func (p *Protocol) getNetwork(bssid string) *network {
+	n, found := p.networks[bssid]
+	if !found {
+		n = &network{bssid: bssid, clients: make(map[string]bool)}
+		p.networks[bssid] = n
+	}
+	return n
+}
+
+// Returns the station with the given address, or creates a new one
+func (p *Protocol) getStation(address string) *station {
+	s, found := p.stations[address]
+	if !found {
+		s = &station{address: address}
+		p.stations[address] = s
+	}
+	return s
+}
+
+// Returns the networks the given client was seen in, sorted by BSSID
+func (p *Protocol) networksOf(client string) []string {
+	var networks []string
+	for bssid, n := range p.networks {
+		if n.clients[client] {
+			networks = append(networks, fmt.Sprintf("%s (%s)", bssid, ssidName(n.ssid)))
+		}
+	}
+	sort.Strings(networks)
+	return networks
+}
+
+// Returns the strongest signal received from the given transmitter, or an empty string if unknown
+func (p *Protocol) signal(transmitter string) string {
+	if s, found := p.signals[transmitter]; found {
+		return fmt.Sprintf("%d dBm", s)
+	}
+	return ""
+}
+
+// Returns a readable name of the given SSID
+func ssidName(ssid string) string {
+	if ssid == "" {
+		return "(hidden)"
+	}
+	return ssid
+}
+
+// Returns a readable name of the given receiver address
+func addressName(address net.HardwareAddr) string {
+	if address.String() == "ff:ff:ff:ff:ff:ff" {
+		return "broadcast"
+	}
+	return address.String()
+}
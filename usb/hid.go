@@ -0,0 +1,37 @@
+package usb
+
+// Reported in all key slots if too many keys are pressed at once
+const keyErrorRollOver = 0x01
+
+// IsKeyboardReport checks if the given transfer is a report of a keyboard speaking the HID boot protocol:
+// 8 bytes sent by the device, starting with the modifiers and a reserved byte, followed by up to six pressed keys.
+// Reports stating that too many keys are pressed are ignored, as they don't tell which keys are pressed.
+func IsKeyboardReport(t *Transfer) bool {
+	if t.Type != TransferInterrupt || !t.In || !t.Completion || len(t.Data) != 8 || t.Data[1] != 0 {
+		return false
+	}
+
+	for _, key := range t.Data[2:] {
+		if key == keyErrorRollOver {
+			return false
+		}
+		if key != 0 && (key < 0x04 || key > 0xe7) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsKeyboardRollOver checks if the given transfer is a report of a keyboard stating that too many keys are pressed,
+// i.e. an 8 byte report with all key slots set to the roll over error
+func IsKeyboardRollOver(t *Transfer) bool {
+	if t.Type != TransferInterrupt || !t.In || !t.Completion || len(t.Data) != 8 || t.Data[1] != 0 {
+		return false
+	}
+	for _, key := range t.Data[2:] {
+		if key != keyErrorRollOver {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package usb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// Link type of the legacy usbmon format, with a shorter header than the memory-mapped format gopacket knows
+	LinkTypeUSBLinux layers.LinkType = 189
+
+	// Length of the usbmon headers in the legacy and in the memory-mapped format
+	linuxHeaderLength       = 48
+	linuxMappedHeaderLength = 64
+)
+
+// LayerTypeUSBLinux is the layer of packets captured by usbmon in the legacy format
+var LayerTypeUSBLinux = gopacket.RegisterLayerType(2100, gopacket.LayerTypeMetadata{Name: "USBLinux", Decoder: gopacket.DecodeFunc(decodeLinuxLayer)})
+
+// Linux is a packet captured by usbmon in the legacy format
+type Linux struct {
+	layers.BaseLayer
+	Transfer
+}
+
+func init() {
+	layers.LinkTypeMetadata[LinkTypeUSBLinux] = layers.EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeLinuxLayer), Name: "USBLinux", LayerType: LayerTypeUSBLinux}
+}
+
+func (l *Linux) LayerType() gopacket.LayerType {
+	return LayerTypeUSBLinux
+}
+
+// Decodes a packet captured by usbmon in the legacy format
+func decodeLinuxLayer(data []byte, p gopacket.PacketBuilder) error {
+	transfer, ok := decodeLinux(data, linuxHeaderLength)
+	if !ok {
+		return fmt.Errorf("usbmon packet too short (%d bytes)", len(data))
+	}
+
+	l := &Linux{Transfer: *transfer}
+	l.Contents = data[:linuxHeaderLength]
+	l.Payload = data[linuxHeaderLength:]
+	p.AddLayer(l)
+	return p.NextDecoder(gopacket.LayerTypePayload)
+}
+
+// Decodes the usbmon header of the given length and the data following it.
+// The header is written in the byte order of the capturing host, which is assumed to be little endian.
+func decodeLinux(data []byte, headerLength int) (*Transfer, bool) {
+	if len(data) < headerLength {
+		return nil, false
+	}
+
+	t := &Transfer{
+		Type:       TransferType(data[9]),
+		Endpoint:   data[10] & 0x7f,
+		In:         data[10]&0x80 != 0,
+		Device:     uint16(data[11]),
+		Bus:        binary.LittleEndian.Uint16(data[12:14]),
+		Completion: data[8] == 'C',
+	}
+
+	// The setup packet is part of the header, flagged by a zero byte
+	if data[14] == 0 {
+		t.Setup = data[40:48]
+	}
+
+	// Captured data follows the header, flagged by a zero byte as well
+	captured := int(binary.LittleEndian.Uint32(data[36:40]))
+	if data[15] == 0 && captured > 0 {
+		end := headerLength + captured
+		if end > len(data) {
+			end = len(data)
+		}
+		t.Data = data[headerLength:end]
+	}
+
+	return t, true
+}
@@ -0,0 +1,82 @@
+// Package usb decodes USB captures, as written by usbmon on Linux and by USBPcap on Windows.
+//
+// gopacket only knows the memory-mapped usbmon format, so the legacy usbmon format and USBPcap are registered as
+// additional link types when this package is imported. Modules don't need to care about the format:
+// Decode returns the transfer of a packet regardless of the capture it comes from.
+package usb
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// TransferType is the kind of a USB transfer
+type TransferType uint8
+
+const (
+	TransferIsochronous TransferType = 0
+	TransferInterrupt   TransferType = 1
+	TransferControl     TransferType = 2
+	TransferBulk        TransferType = 3
+)
+
+// Transfer is a single USB request block, i.e. the submission or completion of a transfer
+type Transfer struct {
+	Bus    uint16
+	Device uint16
+	// Endpoint number, without the direction bit
+	Endpoint uint8
+	// Whether data flows from the device to the host
+	In   bool
+	Type TransferType
+	// Whether this is the completion of the transfer, reported by the device, instead of its submission by the host
+	Completion bool
+	// Setup packet of a control transfer, if present
+	Setup []byte
+	// Data transferred, if captured
+	Data []byte
+}
+
+// Decode returns the USB transfer of the given packet, regardless of the format it was captured in.
+// Returns false if the packet is no USB packet.
+func Decode(packet gopacket.Packet) (*Transfer, bool) {
+	switch l := packet.Layers(); {
+	case len(l) == 0:
+		return nil, false
+	case l[0].LayerType() == layers.LayerTypeUSB:
+		// Decoded by gopacket, which only knows the memory-mapped usbmon format
+		return decodeLinux(packet.Data(), linuxMappedHeaderLength)
+	case l[0].LayerType() == LayerTypeUSBLinux:
+		return &l[0].(*Linux).Transfer, true
+	case l[0].LayerType() == LayerTypeUSBPcap:
+		return &l[0].(*USBPcap).Transfer, true
+	}
+	return nil, false
+}
+
+// DeviceID returns the device of the transfer in usbmon notation, e.g. "1.5" for device 5 on bus 1
+func (t *Transfer) DeviceID() string {
+	return fmt.Sprintf("%d.%d", t.Bus, t.Device)
+}
+
+// EndpointID returns the endpoint of the transfer in usbmon notation, e.g. "1.5.1" for endpoint 1 of device 5 on bus 1
+func (t *Transfer) EndpointID() string {
+	return fmt.Sprintf("%d.%d.%d", t.Bus, t.Device, t.Endpoint)
+}
+
+// String returns the kind of the transfer
+func (t TransferType) String() string {
+	switch t {
+	case TransferIsochronous:
+		return "isochronous"
+	case TransferInterrupt:
+		return "interrupt"
+	case TransferControl:
+		return "control"
+	case TransferBulk:
+		return "bulk"
+	}
+	return fmt.Sprintf("unknown (%d)", uint8(t))
+}
@@ -0,0 +1,80 @@
+package usb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// Link type of captures written by USBPcap
+	LinkTypeUSBPcap layers.LinkType = 249
+
+	// Length of the USBPcap header common to all transfers, the actual header may be longer
+	usbPcapHeaderLength = 27
+)
+
+// LayerTypeUSBPcap is the layer of packets captured by USBPcap
+var LayerTypeUSBPcap = gopacket.RegisterLayerType(2101, gopacket.LayerTypeMetadata{Name: "USBPcap", Decoder: gopacket.DecodeFunc(decodeUSBPcap)})
+
+// USBPcap is a packet captured by USBPcap
+type USBPcap struct {
+	layers.BaseLayer
+	Transfer
+	// Status reported by the USB stack, 0 on success
+	Status uint32
+}
+
+func init() {
+	layers.LinkTypeMetadata[LinkTypeUSBPcap] = layers.EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeUSBPcap), Name: "USBPcap", LayerType: LayerTypeUSBPcap}
+}
+
+func (u *USBPcap) LayerType() gopacket.LayerType {
+	return LayerTypeUSBPcap
+}
+
+// Decodes a packet captured by USBPcap. All fields are little endian.
+func decodeUSBPcap(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) < usbPcapHeaderLength {
+		return fmt.Errorf("USBPcap packet too short (%d bytes)", len(data))
+	}
+	headerLength := int(binary.LittleEndian.Uint16(data[0:2]))
+	if headerLength < usbPcapHeaderLength || headerLength > len(data) {
+		return fmt.Errorf("invalid USBPcap header length %d", headerLength)
+	}
+
+	u := &USBPcap{
+		Transfer: Transfer{
+			Completion: data[16]&0x01 != 0,
+			Bus:        binary.LittleEndian.Uint16(data[17:19]),
+			Device:     binary.LittleEndian.Uint16(data[19:21]),
+			Endpoint:   data[21] & 0x7f,
+			In:         data[21]&0x80 != 0,
+			Type:       TransferType(data[22]),
+		},
+		Status: binary.LittleEndian.Uint32(data[10:14]),
+	}
+
+	// Data follows the header
+	length := int(binary.LittleEndian.Uint32(data[23:27]))
+	end := headerLength + length
+	if end > len(data) {
+		end = len(data)
+	}
+	if end > headerLength {
+		u.Data = data[headerLength:end]
+	}
+
+	// Control transfers state their stage after the common header, the setup stage carries the setup packet as data
+	if u.Type == TransferControl && headerLength > usbPcapHeaderLength && data[usbPcapHeaderLength] == 0 && len(u.Data) >= 8 {
+		u.Setup = u.Data[:8]
+		u.Data = u.Data[8:]
+	}
+
+	u.Contents = data[:headerLength]
+	u.Payload = data[headerLength:]
+	p.AddLayer(u)
+	return p.NextDecoder(gopacket.LayerTypePayload)
+}